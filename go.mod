@@ -3,8 +3,12 @@ module github.com/lupinthe14th/acm
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/eclipse/paho.golang v0.12.0
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/rs/zerolog v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
+	periph.io/x/conn/v3 v3.7.0
 	periph.io/x/devices/v3 v3.7.1
 	periph.io/x/host/v3 v3.8.2
 )
@@ -13,8 +17,8 @@ require (
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sync v0.4.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	periph.io/x/conn/v3 v3.7.0 // indirect
 )
@@ -0,0 +1,92 @@
+// Package aggregate summarises the readings of each sensor over a fixed
+// window so that fast sampling does not mean fast publishing.
+package aggregate
+
+import (
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// Window collects readings until its length has elapsed. It is not safe for
+// concurrent use.
+type Window struct {
+	length time.Duration
+	start  time.Time // when the first reading of the window was added; zero if empty
+
+	order []string // sensor IDs in the order they were first seen
+	accs  map[string]*acc
+}
+
+// acc accumulates the readings of one sensor.
+type acc struct {
+	sensor sensor.Sensor
+	last   sensor.Reading
+	stats  sensor.Stats
+	sum    float64
+}
+
+// New returns an empty window of the given length.
+func New(length time.Duration) *Window {
+	return &Window{length: length, accs: map[string]*acc{}}
+}
+
+// Add folds r, read from s at now, into the window. Readings without a
+// measurement are ignored.
+func (w *Window) Add(s sensor.Sensor, r sensor.Reading, now time.Time) {
+	ms := r.Measurements()
+	if len(ms) == 0 {
+		return
+	}
+	v := ms[0].Value
+	t := r.Time()
+	if t.IsZero() {
+		t = now
+	}
+	if w.start.IsZero() {
+		w.start = now
+	}
+
+	a, ok := w.accs[s.ID()]
+	if !ok {
+		a = &acc{stats: sensor.Stats{Min: v, Max: v, Start: t}}
+		w.accs[s.ID()] = a
+		w.order = append(w.order, s.ID())
+	}
+	a.sensor = s
+	a.last = r
+	a.sum += v
+	a.stats.Count++
+	a.stats.Last = v
+	a.stats.End = t
+	if v < a.stats.Min {
+		a.stats.Min = v
+	}
+	if v > a.stats.Max {
+		a.stats.Max = v
+	}
+}
+
+// Flush returns one result per sensor once the window has elapsed at now, and
+// starts a new window; it returns nil before that. Each reading is the last
+// one of its sensor, carrying the window statistics if it implements
+// sensor.Summary.
+func (w *Window) Flush(now time.Time) []sensor.Result {
+	if w.start.IsZero() || now.Sub(w.start) < w.length {
+		return nil
+	}
+	rs := make([]sensor.Result, 0, len(w.order))
+	for _, id := range w.order {
+		a := w.accs[id]
+		a.stats.Mean = a.sum / float64(a.stats.Count)
+		r := a.last
+		if s, ok := r.(sensor.Summary); ok {
+			r = s.WithStats(a.stats)
+		}
+		rs = append(rs, sensor.Result{Sensor: a.sensor, Reading: r})
+	}
+	w.start = time.Time{}
+	w.order = nil
+	w.accs = map[string]*acc{}
+	return rs
+}
@@ -0,0 +1,75 @@
+package aggregate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+type fakeReading struct {
+	value float64
+	time  time.Time
+	stats *sensor.Stats
+}
+
+func (r fakeReading) Measurements() []sensor.Measurement {
+	return []sensor.Measurement{{Kind: sensor.Temperature, Value: r.value, Unit: "Cel"}}
+}
+func (r fakeReading) Time() time.Time      { return r.time }
+func (r fakeReading) Stats() *sensor.Stats { return r.stats }
+func (r fakeReading) WithStats(st sensor.Stats) sensor.Reading {
+	r.stats = &st
+	return r
+}
+
+type fakeSensor string
+
+func (s fakeSensor) ID() string                                     { return string(s) }
+func (s fakeSensor) Kind() sensor.Kind                              { return sensor.Temperature }
+func (s fakeSensor) Sample(context.Context) (sensor.Reading, error) { return nil, nil }
+
+func TestWindow(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	w := New(time.Minute)
+	if rs := w.Flush(at(120)); rs != nil {
+		t.Fatalf("empty window: got %v, want nil", rs)
+	}
+	for i, v := range []float64{25, 24, 27, 26} {
+		now := at(15 * i)
+		w.Add(fakeSensor("a"), fakeReading{value: v, time: now}, now)
+		if i < 2 {
+			w.Add(fakeSensor("b"), fakeReading{value: v + 10, time: now}, now)
+		}
+		if rs := w.Flush(now); rs != nil {
+			t.Fatalf("at index %d: window closed early: %v", i, rs)
+		}
+	}
+
+	rs := w.Flush(at(60))
+	if len(rs) != 2 || rs[0].Sensor.ID() != "a" || rs[1].Sensor.ID() != "b" {
+		t.Fatalf("unexpected value: got: %v, want: results for a and b", rs)
+	}
+	want := []sensor.Stats{
+		{Min: 24, Max: 27, Mean: 25.5, Count: 4, Last: 26, Start: at(0), End: at(45)},
+		{Min: 34, Max: 35, Mean: 34.5, Count: 2, Last: 34, Start: at(0), End: at(15)},
+	}
+	for i, r := range rs {
+		got := r.Reading.(sensor.Summary).Stats()
+		if got == nil || !reflect.DeepEqual(*got, want[i]) {
+			t.Errorf("at index %d: unexpected value: got: %+v, want: %+v", i, got, want[i])
+		}
+		if v := r.Reading.Measurements()[0].Value; v != want[i].Last {
+			t.Errorf("at index %d: unexpected value: got: %v, want: %v", i, v, want[i].Last)
+		}
+	}
+
+	// A new window starts with the next reading
+	if rs := w.Flush(at(180)); rs != nil {
+		t.Errorf("unexpected value: got: %v, want: nil", rs)
+	}
+}
@@ -0,0 +1,40 @@
+// Package backoff computes exponentially increasing delays between retries.
+package backoff
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Backoff doubles the delay after every attempt, starting at Base and never
+// exceeding Max (a zero Max means no limit).
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns the time to wait after the given attempt (counting from 0).
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Base
+	for i := 0; i < attempt && d > 0 && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+	return d
+}
+
+// Sleep waits for the delay of the given attempt; it returns early with the
+// context error if ctx is done first.
+func (b Backoff) Sleep(ctx context.Context, attempt int) error {
+	t := time.NewTimer(b.Delay(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
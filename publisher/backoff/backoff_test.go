@@ -0,0 +1,44 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first attempt", b: Backoff{Base: time.Second, Max: time.Minute}, attempt: 0, want: time.Second},
+		{name: "doubles", b: Backoff{Base: time.Second, Max: time.Minute}, attempt: 3, want: 8 * time.Second},
+		{name: "capped", b: Backoff{Base: time.Second, Max: time.Minute}, attempt: 10, want: time.Minute},
+		{name: "base above max", b: Backoff{Base: 2 * time.Minute, Max: time.Minute}, attempt: 0, want: time.Minute},
+		{name: "no max", b: Backoff{Base: time.Second}, attempt: 4, want: 16 * time.Second},
+		{name: "overflow", b: Backoff{Base: time.Second, Max: time.Hour}, attempt: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.b.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay(%d) = %s; want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSleepCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := (Backoff{Base: time.Minute}).Sleep(ctx, 0); err != context.Canceled {
+		t.Errorf("Sleep() = %v; want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Sleep() did not return on cancellation")
+	}
+}
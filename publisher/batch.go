@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// Batch statuses of probes without a reading, besides the ds18b20 validation statuses
+const (
+	batchOffline = "offline" // the probe is no longer found on the bus
+	batchError   = "error"   // the probe could not be read
+)
+
+// defaultBatchTopic returns the device level topic batches are published on when none is configured
+func defaultBatchTopic(base string) string {
+	return strings.Join([]string{base, "batch"}, "/")
+}
+
+// batchEntry returns the batch entry for the outcome of sampling a probe
+func batchEntry(r sensor.Result) codec.Entry {
+	e := codec.Entry{Sensor: r.Sensor, Reading: r.Reading, Status: codec.StatusOK}
+	if r.Err == nil {
+		return e
+	}
+	e.Reading = nil
+	e.Error = r.Err.Error()
+	var re *ds18b20.ReadingError
+	switch {
+	case errors.Is(r.Err, sensor.ErrOffline):
+		e.Status = batchOffline
+	case errors.As(r.Err, &re):
+		e.Status = re.Status.String()
+	default:
+		e.Status = batchError
+	}
+	return e
+}
+
+// batchStatuses holds the status of every probe in the last published batch, by sensor ID, so that a probe
+// failing the same way cycle after cycle, e.g. one that was unplugged, does not force a batch out every time
+type batchStatuses map[string]string
+
+// changed reports whether the status of e differs from the one it had in the last published batch
+func (b batchStatuses) changed(e codec.Entry) bool {
+	s, ok := b[e.Sensor.ID()]
+	return !ok || s != e.Status
+}
+
+// published records the statuses of the entries of a published batch
+func (b batchStatuses) published(es []codec.Entry) {
+	for _, e := range es {
+		b[e.Sensor.ID()] = e.Status
+	}
+}
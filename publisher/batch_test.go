@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+func TestBatchEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    sensor.Result
+		wantValue string
+		isReading bool
+	}{
+		{name: "ok case", result: sensor.Result{Reading: ds18b20.Env{Temperature: 25}}, wantValue: "ok", isReading: true},
+		{name: "offline case", result: sensor.Result{Err: fmt.Errorf("device 28: %w", sensor.ErrOffline)}, wantValue: "offline"},
+		{name: "validation case", result: sensor.Result{Err: &ds18b20.ReadingError{Status: ds18b20.StatusPowerOnReset}}, wantValue: "power-on-reset"},
+		{name: "error case", result: sensor.Result{Err: errors.New("bus gone")}, wantValue: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := batchEntry(tt.result)
+			if got.Status != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got.Status, tt.wantValue)
+			}
+			if (got.Reading != nil) != tt.isReading {
+				t.Errorf("unexpected value: got: %v, want reading: %v", got.Reading, tt.isReading)
+			}
+			if (got.Error != "") == tt.isReading {
+				t.Errorf("unexpected error: %q", got.Error)
+			}
+		})
+	}
+}
+
+func TestBatchStatuses(t *testing.T) {
+	ds, err := ds18b20.Open(ds18b20.Config{Backend: ds18b20.BackendSim, Sim: ds18b20.SimConfig{Probes: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ds.Sensors()[0]
+	offline := batchEntry(sensor.Result{Sensor: s, Err: fmt.Errorf("device %s: %w", s.ID(), sensor.ErrOffline)})
+	ok := batchEntry(sensor.Result{Sensor: s, Reading: ds18b20.Env{Temperature: 25}})
+
+	b := batchStatuses{}
+	if !b.changed(offline) {
+		t.Error("unexpected value: a probe missing from the last batch must count as changed")
+	}
+	b.published([]codec.Entry{offline})
+	if b.changed(offline) {
+		t.Error("unexpected value: a probe that is still offline must not count as changed")
+	}
+	if !b.changed(ok) {
+		t.Error("unexpected value: a probe that came back must count as changed")
+	}
+}
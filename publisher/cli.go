@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// version of the publisher, set when building with -ldflags "-X main.version=..."
+var version = "dev"
+
+// Output formats of the scan and read commands
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// command is a subcommand of the publisher binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+// commands lists the subcommands; run is used when none is given
+var commands = []command{
+	{name: "run", summary: "connect to the broker and publish readings until interrupted", run: runCmd},
+	{name: "scan", summary: "list the 1-wire addresses found by the bus search", run: scanCmd},
+	{name: "read", summary: "read every probe once and print the readings", run: readCmd},
+	{name: "check-config", summary: "load and validate the configuration", run: checkConfigCmd},
+	{name: "version", summary: "print the version of the publisher", run: versionCmd},
+}
+
+// runCommand runs the subcommand named by the first argument, the remaining arguments being its flags
+func runCommand(args []string, stdout io.Writer) error {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(stdout)
+		return nil
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args, stdout)
+		}
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// usage lists the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// newFlagSet returns the flags of a command, with the -config flag every command but version takes
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "path of the YAML or TOML configuration file (default $"+envConfigFile+")")
+	return fs, configFile
+}
+
+// loadConfigFile reads the configuration file given by the -config flag or the environment
+func loadConfigFile(path string) error {
+	var err error
+	fileConfig, err = readConfigFile(configFilePath(path))
+	return err
+}
+
+// runCmd connects to the broker and publishes readings until a signal is caught
+func runCmd(args []string, _ io.Writer) error {
+	fs, configFile := newFlagSet("run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfigFile(*configFile); err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	cfg, err := getConfig()
+	if err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	serve(cfg)
+	return nil
+}
+
+// checkConfigCmd loads the configuration and reports whether it is valid
+func checkConfigCmd(args []string, stdout io.Writer) error {
+	fs, configFile := newFlagSet("check-config")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := loadConfigFile(*configFile); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	cfg, err := getConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	brokers := make([]string, 0, len(cfg.serverURLs))
+	for _, u := range cfg.serverURLs {
+		brokers = append(brokers, u.Redacted())
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "brokers:\t%s\n", strings.Join(brokers, ", "))
+	fmt.Fprintf(tw, "client id:\t%s\n", cfg.clientID)
+	fmt.Fprintf(tw, "topic:\t%s\n", cfg.topicTemplate)
+	fmt.Fprintf(tw, "status topic:\t%s\n", cfg.statusTopic)
+	fmt.Fprintf(tw, "encoding:\t%s\n", cfg.encoder.ContentType())
+	fmt.Fprintf(tw, "sensor backend:\t%s\n", backendName(cfg.sensors.Backend))
+	tw.Flush()
+	fmt.Fprintln(stdout, "configuration is valid")
+	return nil
+}
+
+// versionCmd prints the version of the publisher
+func versionCmd(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "publisher %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// scanEntry is a device found by the scan command
+type scanEntry struct {
+	Address   string      `json:"address"`
+	Family    string      `json:"family"`
+	Permitted bool        `json:"permitted"` // false if excluded by acm_allow or acm_deny
+	Meta      sensor.Meta `json:"meta"`
+}
+
+// scanCmd lists the devices found by the bus search, whether or not they are used
+func scanCmd(args []string, stdout io.Writer) error {
+	fs, configFile := newFlagSet("scan")
+	format := fs.String("format", formatTable, "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if err := loadConfigFile(*configFile); err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	sc, err := sensorsFromEnv()
+	if err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+
+	found, err := ds18b20.Scan(sc)
+	if err != nil {
+		return fmt.Errorf("error scanning buses: %w", err)
+	}
+	es := make([]scanEntry, 0, len(found))
+	for _, f := range found {
+		es = append(es, scanEntry{
+			Address:   fmt.Sprintf("%x", f.Address),
+			Family:    fmt.Sprintf("%02x", f.Family()),
+			Permitted: f.Permitted,
+			Meta:      sc.Meta[f.Address],
+		})
+	}
+
+	if *format == formatJSON {
+		return writeJSON(stdout, es)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tFAMILY\tUSED\tALIAS\tTANK\tLOCATION")
+	for _, e := range es {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Address, e.Family, yesNo(e.Permitted), e.Meta.Alias, e.Meta.Tank, e.Meta.Location)
+	}
+	return tw.Flush()
+}
+
+// readCmd reads every probe once and prints the readings, in the format of a JSON batch when requested
+func readCmd(args []string, stdout io.Writer) error {
+	fs, configFile := newFlagSet("read")
+	format := fs.String("format", formatTable, "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	if err := loadConfigFile(*configFile); err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	sc, err := sensorsFromEnv()
+	if err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+
+	ds, err := ds18b20.Open(sc)
+	defer ds.Close()
+	if err == nil && len(ds.GetDevs()) == 0 {
+		err = errNoSensors
+	}
+	if err != nil {
+		return fmt.Errorf("error opening sensors: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var es []codec.Entry
+	for _, r := range ds.SampleAll(ctx) {
+		es = append(es, batchEntry(r))
+	}
+
+	if *format == formatJSON {
+		msg, err := codec.JSON{}.EncodeBatch(time.Now(), es)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", msg)
+		return err
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tALIAS\tTANK\tLOCATION\tTEMPERATURE\tSTATUS\tERROR")
+	for _, e := range es {
+		var m sensor.Meta
+		if d, ok := e.Sensor.(sensor.Describer); ok {
+			m = d.Meta()
+		}
+		temp := "-"
+		if e.Reading != nil {
+			if ms := e.Reading.Measurements(); len(ms) > 0 {
+				temp = fmt.Sprintf("%.2f", ms[0].Value)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Sensor.ID(), m.Alias, m.Tank, m.Location, temp, e.Status, e.Error)
+	}
+	return tw.Flush()
+}
+
+// checkFormat ensures the output format is one the scan and read commands support
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON:
+		return nil
+	default:
+		return fmt.Errorf("format must be one of %s, %s (is %s)", formatTable, formatJSON, format)
+	}
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// backendName returns the name of the sensor backend, the default one if blank
+func backendName(b ds18b20.Backend) ds18b20.Backend {
+	if b == "" {
+		return ds18b20.BackendNetlink
+	}
+	return b
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
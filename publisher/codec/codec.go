@@ -0,0 +1,118 @@
+// Package codec turns sensor readings into message payloads.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// Encoder produces the payload published for a reading, or for every sensor
+// sampled in a cycle when batching.
+type Encoder interface {
+	Encode(s sensor.Sensor, r sensor.Reading) ([]byte, error)
+	EncodeBatch(t time.Time, es []Entry) ([]byte, error)
+	ContentType() string // MIME type of the payload, sent as the MQTT v5 content type
+}
+
+// StatusOK is the status of a sensor that was read successfully.
+const StatusOK = "ok"
+
+// Entry is the outcome of sampling one sensor, as put in a batch.
+type Entry struct {
+	Sensor  sensor.Sensor
+	Reading sensor.Reading // nil unless the sensor was read successfully
+	Status  string         // StatusOK or why there is no reading, e.g. "offline"
+	Error   string         // description of the failure
+}
+
+// batch is the payload of JSON and CBOR batches.
+type batch struct {
+	Timestamp time.Time    `json:"timestamp"`
+	Sensors   []batchEntry `json:"sensors"`
+}
+
+type batchEntry struct {
+	ID string `json:"id"`
+	sensor.Meta
+	Status  string         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Reading sensor.Reading `json:"reading,omitempty"`
+}
+
+func newBatch(t time.Time, es []Entry) batch {
+	b := batch{Timestamp: t, Sensors: make([]batchEntry, 0, len(es))}
+	for _, e := range es {
+		be := batchEntry{ID: e.Sensor.ID(), Status: e.Status, Error: e.Error, Reading: e.Reading}
+		if d, ok := e.Sensor.(sensor.Describer); ok {
+			be.Meta = d.Meta()
+		}
+		b.Sensors = append(b.Sensors, be)
+	}
+	return b
+}
+
+// Names of the available encoders, as used in the configuration.
+const (
+	NameJSON         = "json"
+	NameCBOR         = "cbor"
+	NameSenML        = "senml"
+	NameLineProtocol = "influx"
+)
+
+// Names lists the encoders accepted by ByName.
+var Names = []string{NameJSON, NameCBOR, NameSenML, NameLineProtocol}
+
+// ByName returns the encoder registered under name; an empty name selects JSON.
+func ByName(name string) (Encoder, error) {
+	switch name {
+	case "", NameJSON:
+		return JSON{}, nil
+	case NameCBOR:
+		return CBOR{}, nil
+	case NameSenML:
+		return SenML{}, nil
+	case NameLineProtocol:
+		return LineProtocol{}, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q (must be one of %s)", name, strings.Join(Names, ", "))
+}
+
+// JSON encodes the reading as a JSON object; this is the historic payload.
+type JSON struct{}
+
+// Encode implements Encoder.
+func (JSON) Encode(_ sensor.Sensor, r sensor.Reading) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// EncodeBatch implements Encoder.
+func (JSON) EncodeBatch(t time.Time, es []Entry) ([]byte, error) {
+	return json.Marshal(newBatch(t, es))
+}
+
+// ContentType implements Encoder.
+func (JSON) ContentType() string { return "application/json" }
+
+// cborMode writes timestamps as epoch numbers, which is much shorter than text.
+var cborMode, _ = cbor.EncOptions{Time: cbor.TimeUnixDynamic}.EncMode()
+
+// CBOR encodes the reading with the same fields as JSON, in RFC 8949 binary form.
+type CBOR struct{}
+
+// Encode implements Encoder.
+func (CBOR) Encode(_ sensor.Sensor, r sensor.Reading) ([]byte, error) {
+	return cborMode.Marshal(r)
+}
+
+// EncodeBatch implements Encoder.
+func (CBOR) EncodeBatch(t time.Time, es []Entry) ([]byte, error) {
+	return cborMode.Marshal(newBatch(t, es))
+}
+
+// ContentType implements Encoder.
+func (CBOR) ContentType() string { return "application/cbor" }
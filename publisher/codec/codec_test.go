@@ -0,0 +1,248 @@
+package codec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+type fakeReading struct {
+	ID          string    `json:"id"`
+	Temperature float64   `json:"temperature"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (r fakeReading) Measurements() []sensor.Measurement {
+	return []sensor.Measurement{{Kind: sensor.Temperature, Value: r.Temperature, Unit: "Cel"}}
+}
+
+func (r fakeReading) Time() time.Time { return r.Timestamp }
+
+// fakeSummary is an aggregated reading.
+type fakeSummary struct {
+	fakeReading
+	Window *sensor.Stats `json:"stats,omitempty"`
+}
+
+func (r fakeSummary) Stats() *sensor.Stats { return r.Window }
+func (r fakeSummary) WithStats(st sensor.Stats) sensor.Reading {
+	r.Window = &st
+	return r
+}
+
+type fakeSensor struct {
+	id   string
+	meta sensor.Meta
+}
+
+func (s fakeSensor) ID() string                                     { return s.id }
+func (s fakeSensor) Kind() sensor.Kind                              { return sensor.Temperature }
+func (s fakeSensor) Meta() sensor.Meta                              { return s.meta }
+func (s fakeSensor) Sample(context.Context) (sensor.Reading, error) { return nil, nil }
+
+var (
+	ts      = time.Date(2023, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	reading = fakeReading{ID: "293ce10457784c28", Temperature: 25.5, Timestamp: ts}
+	summary = fakeSummary{reading, &sensor.Stats{Min: 24, Max: 26, Mean: 25.25, Count: 4, Last: 25.5, Start: ts.Add(-time.Minute), End: ts}}
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  string
+		sensor    sensor.Sensor
+		reading   sensor.Reading
+		wantType  string
+		wantValue string
+	}{
+		{
+			name:      "json",
+			encoding:  NameJSON,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   reading,
+			wantType:  "application/json",
+			wantValue: `{"id":"293ce10457784c28","temperature":25.5,"timestamp":"2023-01-02T03:04:05.5Z"}`,
+		},
+		{
+			name:      "default is json",
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   reading,
+			wantType:  "application/json",
+			wantValue: `{"id":"293ce10457784c28","temperature":25.5,"timestamp":"2023-01-02T03:04:05.5Z"}`,
+		},
+		{
+			name:      "senml",
+			encoding:  NameSenML,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   reading,
+			wantType:  "application/senml+json",
+			wantValue: `[{"bn":"urn:dev:ow:293ce10457784c28:","bt":1672628645.5,"n":"temperature","u":"Cel","v":25.5}]`,
+		},
+		{
+			name:      "senml zero value",
+			encoding:  NameSenML,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   fakeReading{},
+			wantType:  "application/senml+json",
+			wantValue: `[{"bn":"urn:dev:ow:293ce10457784c28:","n":"temperature","u":"Cel","v":0}]`,
+		},
+		{
+			name:      "json aggregated",
+			encoding:  NameJSON,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   summary,
+			wantType:  "application/json",
+			wantValue: `{"id":"293ce10457784c28","temperature":25.5,"timestamp":"2023-01-02T03:04:05.5Z","stats":{"min":24,"max":26,"mean":25.25,"count":4,"last":25.5,"start":"2023-01-02T03:03:05.5Z","end":"2023-01-02T03:04:05.5Z"}}`,
+		},
+		{
+			name:     "senml aggregated",
+			encoding: NameSenML,
+			sensor:   fakeSensor{id: "293ce10457784c28"},
+			reading:  summary,
+			wantType: "application/senml+json",
+			wantValue: `[{"bn":"urn:dev:ow:293ce10457784c28:","bt":1672628645.5,"n":"temperature","u":"Cel","v":25.5},` +
+				`{"n":"temperature:min","u":"Cel","v":24},{"n":"temperature:max","u":"Cel","v":26},` +
+				`{"n":"temperature:mean","u":"Cel","v":25.25},{"n":"temperature:count","v":4}]`,
+		},
+		{
+			name:      "line protocol aggregated",
+			encoding:  NameLineProtocol,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   summary,
+			wantType:  "text/plain; charset=utf-8",
+			wantValue: `temperature,id=293ce10457784c28,unit=Cel value=25.5,min=24,max=26,mean=25.25,count=4i 1672628645500000000`,
+		},
+		{
+			name:      "line protocol",
+			encoding:  NameLineProtocol,
+			sensor:    fakeSensor{id: "293ce10457784c28"},
+			reading:   reading,
+			wantType:  "text/plain; charset=utf-8",
+			wantValue: `temperature,id=293ce10457784c28,unit=Cel value=25.5 1672628645500000000`,
+		},
+		{
+			name:      "line protocol with metadata",
+			encoding:  NameLineProtocol,
+			sensor:    fakeSensor{id: "293ce10457784c28", meta: sensor.Meta{Alias: "sump", Tank: "display tank", Location: "a,b=c"}},
+			reading:   fakeReading{Temperature: -1},
+			wantType:  "text/plain; charset=utf-8",
+			wantValue: `temperature,alias=sump,id=293ce10457784c28,location=a\,b\=c,tank=display\ tank,unit=Cel value=-1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := ByName(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := enc.ContentType(); got != tt.wantType {
+				t.Errorf("unexpected content type: got: %s, want: %s", got, tt.wantType)
+			}
+			got, err := enc.Encode(tt.sensor, tt.reading)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	enc, err := ByName(NameCBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := enc.ContentType(); got != "application/cbor" {
+		t.Errorf("unexpected content type: got: %s, want: application/cbor", got)
+	}
+	b, err := enc.Encode(fakeSensor{id: reading.ID}, reading)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got fakeReading
+	if err := cbor.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != reading.ID || got.Temperature != reading.Temperature || !got.Timestamp.Equal(reading.Timestamp) {
+		t.Errorf("unexpected value: got: %+v, want: %+v", got, reading)
+	}
+}
+
+func TestByNameUnknown(t *testing.T) {
+	if _, err := ByName("xml"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	es := []Entry{
+		{Sensor: fakeSensor{id: "293ce10457784c28", meta: sensor.Meta{Alias: "sump"}}, Reading: reading, Status: StatusOK},
+		{Sensor: fakeSensor{id: "293ce10457784c29"}, Status: "offline", Error: "sensor is offline"},
+	}
+	tests := []struct {
+		name      string
+		encoding  string
+		wantValue string
+	}{
+		{
+			name:     "json",
+			encoding: NameJSON,
+			wantValue: `{"timestamp":"2023-01-02T03:04:05.5Z","sensors":[` +
+				`{"id":"293ce10457784c28","alias":"sump","status":"ok","reading":{"id":"293ce10457784c28","temperature":25.5,"timestamp":"2023-01-02T03:04:05.5Z"}},` +
+				`{"id":"293ce10457784c29","status":"offline","error":"sensor is offline"}]}`,
+		},
+		{
+			name:     "senml",
+			encoding: NameSenML,
+			wantValue: `[{"bn":"urn:dev:ow:293ce10457784c28:","bt":1672628645.5,"n":"temperature","u":"Cel","v":25.5},{"n":"status","vs":"ok"},` +
+				`{"bn":"urn:dev:ow:293ce10457784c29:","bt":1672628645.5,"n":"status","vs":"offline"}]`,
+		},
+		{
+			name:     "line protocol",
+			encoding: NameLineProtocol,
+			wantValue: "temperature,alias=sump,id=293ce10457784c28,unit=Cel value=25.5 1672628645500000000\n" +
+				`sensor_status,alias=sump,id=293ce10457784c28 status="ok" 1672628645500000000` + "\n" +
+				`sensor_status,id=293ce10457784c29 status="offline" 1672628645500000000`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := ByName(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := enc.EncodeBatch(ts, es)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+
+	b, err := CBOR{}.EncodeBatch(ts, es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Sensors []struct {
+			ID      string      `json:"id"`
+			Status  string      `json:"status"`
+			Reading fakeReading `json:"reading"`
+		} `json:"sensors"`
+	}
+	if err := cbor.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Sensors) != 2 || got.Sensors[0].Reading.Temperature != 25.5 || got.Sensors[1].Status != "offline" {
+		t.Errorf("unexpected value: got: %+v", got)
+	}
+}
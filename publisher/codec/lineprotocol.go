@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// statusMeasurement is the line protocol measurement carrying the status of
+// each sensor in a batch.
+const statusMeasurement = "sensor_status"
+
+// LineProtocol encodes the reading as InfluxDB line protocol, one line per
+// measurement, e.g.
+//
+//	temperature,alias=sump,id=293ce10457784c28,unit=Cel value=25.5 1672628645000000000
+//
+// Aggregated readings carry min, max, mean and count fields as well. In a
+// batch every sensor also gets a sensor_status line.
+type LineProtocol struct{}
+
+// Encode implements Encoder.
+func (LineProtocol) Encode(s sensor.Sensor, r sensor.Reading) ([]byte, error) {
+	var b strings.Builder
+	writeReading(&b, s, r)
+	return []byte(b.String()), nil
+}
+
+// EncodeBatch implements Encoder.
+func (LineProtocol) EncodeBatch(t time.Time, es []Entry) ([]byte, error) {
+	var b strings.Builder
+	for _, e := range es {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		if e.Reading != nil {
+			writeReading(&b, e.Sensor, e.Reading)
+			b.WriteByte('\n')
+		}
+		b.WriteString(statusMeasurement)
+		writeTags(&b, e.Sensor)
+		b.WriteString(` status="` + stringEscaper.Replace(e.Status) + `"`)
+		writeTime(&b, t)
+	}
+	return []byte(b.String()), nil
+}
+
+// writeReading writes one line per measurement of r
+func writeReading(b *strings.Builder, s sensor.Sensor, r sensor.Reading) {
+	var st *sensor.Stats
+	if sr, ok := r.(sensor.Summary); ok {
+		st = sr.Stats()
+	}
+
+	for i, m := range r.Measurements() {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(measurementEscaper.Replace(string(m.Kind)))
+		writeTags(b, s)
+		writeTag(b, "unit", m.Unit)
+		b.WriteString(" value=")
+		b.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+		if i == 0 && st != nil { // window statistics belong to the primary measurement
+			for _, f := range []struct {
+				key   string
+				value float64
+			}{{"min", st.Min}, {"max", st.Max}, {"mean", st.Mean}} {
+				b.WriteString("," + f.key + "=")
+				b.WriteString(strconv.FormatFloat(f.value, 'f', -1, 64))
+			}
+			b.WriteString(",count=" + strconv.Itoa(st.Count) + "i")
+		}
+		writeTime(b, r.Time())
+	}
+}
+
+// writeTags writes the tags identifying s, in key order as recommended for write performance
+func writeTags(b *strings.Builder, s sensor.Sensor) {
+	var meta sensor.Meta
+	if d, ok := s.(sensor.Describer); ok {
+		meta = d.Meta()
+	}
+	writeTag(b, "alias", meta.Alias)
+	writeTag(b, "id", s.ID())
+	writeTag(b, "location", meta.Location)
+	writeTag(b, "tank", meta.Tank)
+}
+
+func writeTag(b *strings.Builder, key, value string) {
+	if value == "" { // empty tag values are not allowed
+		return
+	}
+	b.WriteByte(',')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(tagEscaper.Replace(value))
+}
+
+func writeTime(b *strings.Builder, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+}
+
+// ContentType implements Encoder.
+func (LineProtocol) ContentType() string { return "text/plain; charset=utf-8" }
@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// senmlBaseName prefixes the sensor ID to form the SenML base name; 1-wire
+// devices have their own URN namespace (RFC 9039).
+const senmlBaseName = "urn:dev:ow:"
+
+// senmlRecord is a single RFC 8428 record.
+type senmlRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"` // seconds since the epoch
+	Name        string   `json:"n"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue string   `json:"vs,omitempty"`
+}
+
+// SenML encodes the reading as an RFC 8428 JSON pack holding one record per
+// measurement, followed by <kind>:min, :max, :mean and :count records for
+// aggregated readings. In a batch every sensor also gets a "status" record.
+type SenML struct{}
+
+// Encode implements Encoder.
+func (SenML) Encode(s sensor.Sensor, r sensor.Reading) ([]byte, error) {
+	return json.Marshal(senmlRecords(s, r, time.Time{}))
+}
+
+// EncodeBatch implements Encoder.
+func (SenML) EncodeBatch(t time.Time, es []Entry) ([]byte, error) {
+	pack := []senmlRecord{}
+	for _, e := range es {
+		rs := []senmlRecord{{Name: "status", StringValue: e.Status}}
+		if e.Reading != nil {
+			rs = append(senmlRecords(e.Sensor, e.Reading, t), rs...)
+		} else {
+			setBase(rs, e.Sensor, t)
+		}
+		pack = append(pack, rs...)
+	}
+	return json.Marshal(pack)
+}
+
+// senmlRecords returns the records for r; t is used when r carries no time.
+func senmlRecords(s sensor.Sensor, r sensor.Reading, t time.Time) []senmlRecord {
+	ms := r.Measurements()
+	pack := make([]senmlRecord, 0, len(ms))
+	for _, m := range ms {
+		pack = append(pack, senmlRecord{Name: string(m.Kind), Unit: m.Unit, Value: float(m.Value)})
+	}
+	// Window statistics of the primary measurement are sent as extra records
+	if sr, ok := r.(sensor.Summary); ok && len(ms) > 0 && sr.Stats() != nil {
+		st, m := sr.Stats(), ms[0]
+		name := string(m.Kind) + ":"
+		pack = append(pack,
+			senmlRecord{Name: name + "min", Unit: m.Unit, Value: float(st.Min)},
+			senmlRecord{Name: name + "max", Unit: m.Unit, Value: float(st.Max)},
+			senmlRecord{Name: name + "mean", Unit: m.Unit, Value: float(st.Mean)},
+			senmlRecord{Name: name + "count", Value: float(float64(st.Count))},
+		)
+	}
+	if rt := r.Time(); !rt.IsZero() {
+		t = rt
+	}
+	setBase(pack, s, t)
+	return pack
+}
+
+// setBase puts the base name and time of s on the first record.
+func setBase(pack []senmlRecord, s sensor.Sensor, t time.Time) {
+	if len(pack) == 0 {
+		return
+	}
+	pack[0].BaseName = senmlBaseName + s.ID() + ":"
+	if !t.IsZero() {
+		pack[0].BaseTime = float64(t.UnixNano()) / 1e9
+	}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+// ContentType implements Encoder.
+func (SenML) ContentType() string { return "application/senml+json" }
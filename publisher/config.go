@@ -2,18 +2,24 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/topic"
+	"periph.io/x/conn/v3/onewire"
 )
 
 // Retrieve config from environmental variables
 
 // Configuration will be pulled from the environment using the following keys
 const (
-	envServerURL = "acm_serverURL" // server URL
+	envServerURL = "acm_serverURL" // comma separated server URLs, tried in turn
 	envCAFile    = "acm_caFile"    // CA file to use when connecting to server
 	envClientID  = "acm_clientID"  // client id to connect with
 	envUsername  = "acm_username"  // username to connect with
@@ -21,108 +27,505 @@ const (
 	envTopic     = "acm_topic"     // topic to publish on
 	envQos       = "acm_qos"       // qos to utilise when publishing
 
+	envTopicTemplate = "acm_topicTemplate" // template of the topic readings are published on, referring to {id} or {alias} (default "{topic}/{alias}")
+	envSite          = "acm_site"          // site name, available as {site} in the topic template
+	envStatusTopic   = "acm_statusTopic"   // topic the retained "online"/"offline" availability is published on (default <topic>/status)
+
 	envKeepAlive            = "acm_keepAlive"            // seconds between keep alive packets
 	envConnectRetryDely     = "acm_connectRetryDelay"    // milliseconds to delay between connection attempts
 	envDelayBetweenMessages = "acm_delayBetweenMessages" // millisecods delay between published messages
+	envDrainTimeout         = "acm_drainTimeout"         // milliseconds allowed on shutdown for the messages in flight to be published (default 5000)
+	envRescanInterval       = "acm_rescanInterval"       // milliseconds between searches for added or removed probes (default 60000, 0 disables)
+	envSensorRetryDelay     = "acm_sensorRetryDelay"     // milliseconds before retrying to open the probes, doubled on every failure (default 1000)
+	envSensorRetryMaxDelay  = "acm_sensorRetryMaxDelay"  // maximum milliseconds between attempts to open the probes (default 60000)
+
+	envBatch      = "acm_batch"      // If "true" then all probes are published in a single message per cycle
+	envBatchTopic = "acm_batchTopic" // topic batches are published on (default <topic>/batch)
+
+	envAggregateWindow = "acm_aggregateWindow" // milliseconds over which readings are summarised into one message per probe (default 0, no aggregation)
+
+	envDeadband   = "acm_deadband"   // °C a probe must move by before its reading is published again (default 0, publish every reading)
+	envMaxSilence = "acm_maxSilence" // milliseconds after which a reading is published even if it did not move (default 0, never)
+
+	envProbeDeadbands = "acm_probeDeadbands" // comma separated address:delta deadbands overriding acm_deadband for single probes
+
+	envPublishWorkers    = "acm_publishWorkers"    // number of messages published concurrently (default 4)
+	envPublishQueueDepth = "acm_publishQueueDepth" // number of messages waiting to be published (default 100)
+	envPublishDropPolicy = "acm_publishDropPolicy" // what to do when the queue is full: "block" (default), "drop-oldest" or "drop-newest"
+
+	envSpoolDir      = "acm_spoolDir"      // directory readings are kept in while the broker is unreachable; blank disables store-and-forward
+	envSpoolMaxBytes = "acm_spoolMaxBytes" // maximum size of the spool in bytes, the oldest readings are dropped first (default 10485760)
+	envSpoolMaxAge   = "acm_spoolMaxAge"   // milliseconds a reading is kept in the spool (default 86400000)
+
+	envEncoding = "acm_encoding" // payload format: "json" (default), "cbor", "senml" or "influx"
+
+	envHADiscovery       = "acm_haDiscovery"       // If "true" then Home Assistant discovery messages are published for every probe
+	envHADiscoveryPrefix = "acm_haDiscoveryPrefix" // Home Assistant discovery topic prefix (default "homeassistant")
+	envHANodeID          = "acm_haNodeID"          // node id used in the discovery topics (default the client id)
 
 	envPrintMessages = "acm_printMessages" // If "true" then published messages will be written to the console
 	envDebug         = "acm_debug"         // If "true" then the libraries will be instructed to print debug info
+
+	envSensorBackend     = "acm_sensorBackend"     // ds18b20 backend: "netlink" (default), "sysfs" or "sim"
+	envSysfsRoot         = "acm_sysfsRoot"         // w1 devices directory used by the sysfs backend
+	envBuses             = "acm_buses"             // comma separated 1-wire bus master numbers (default 1)
+	envResolution        = "acm_resolution"        // probe resolution in bits, 9-12 (default 10)
+	envAllow             = "acm_allow"             // comma separated 1-wire addresses; if set only these probes are published
+	envDeny              = "acm_deny"              // comma separated 1-wire addresses that are never published
+	envReadTimeout       = "acm_readTimeout"       // milliseconds a read of the probes may take including retries (default 10000)
+	envReadMaxAttempts   = "acm_readMaxAttempts"   // attempts to read a failing probe (default 3)
+	envReadRetryDelay    = "acm_readRetryDelay"    // milliseconds before retrying a read, doubled on every failure (default 100)
+	envReadRetryMaxDelay = "acm_readRetryMaxDelay" // maximum milliseconds between attempts to read a probe (default 2000)
+	envCalibration       = "acm_calibration"       // comma separated address:offset[:gain] probe corrections
+	envAliases           = "acm_aliases"           // comma separated address:alias[:tank[:location]] probe names
+	envSimProbes         = "acm_simProbes"         // number of simulated probes (default 1)
+	envSimAddrs          = "acm_simAddrs"          // comma separated 1-wire addresses of the simulated probes
+	envSimBaseline       = "acm_simBaseline"       // simulated temperature in °C at start up (default 25)
+	envSimDrift          = "acm_simDrift"          // simulated drift in °C per hour
+	envSimNoise          = "acm_simNoise"          // standard deviation of the simulated noise in °C
+	envSimFailureRate    = "acm_simFailureRate"    // probability (0..1) that a simulated read fails
 )
 
 // config holds the configuration
 type config struct {
-	serverURL *url.URL // MQTT server URL
-	caFile    string   // CA file to use when connecting to server
-	clientID  string   // Client ID to use when connecting to server
-	username  string   // Username to use when connecting to server
-	password  string   // Password to use when connecting to server
-	topic     string   // Topic to subscribe to
-	qos       byte     // QOS to use when subscribing
+	serverURLs []*url.URL // MQTT server URLs
+	caFile     string     // CA file to use when connecting to server
+	clientID   string     // Client ID to use when connecting to server
+	username   string     // Username to use when connecting to server
+	password   string     // Password to use when connecting to server
+	topic      string     // Topic to subscribe to
+	qos        byte       // QOS to use when subscribing
+
+	topicTemplate topic.Template // Template of the topic readings are published on
+	site          string         // Site name used in the topic template
+	statusTopic   string         // Topic the availability of the publisher is published on
 
 	keepAlive            uint16        // seconds between keepalive packets
 	connectRetryDelay    time.Duration // Period between connection attempts
 	delayBetweenMessages time.Duration // Period between publishing message
+	drainTimeout         time.Duration // Period allowed on shutdown for the messages in flight to be published
+	rescanInterval       time.Duration // Period between searches for added or removed probes
+	sensorRetryDelay     time.Duration // Initial period between attempts to open the probes
+	sensorRetryMaxDelay  time.Duration // Maximum period between attempts to open the probes
+	batch                bool          // If true then all probes are published in a single message per cycle
+	batchTopic           string        // Topic batches are published on
+	aggregateWindow      time.Duration // Period over which readings are summarised before publishing
+	deadband             float64       // Change required before a probe is published again
+	maxSilence           time.Duration // Period after which a probe is published even if it did not change
+	publishWorkers       int           // Number of messages published concurrently
+	publishQueueDepth    int           // Number of messages waiting to be published
+	publishDropPolicy    dropPolicy    // What to do when the publish queue is full
+	spoolDir             string        // Directory messages are stored in while the broker is unreachable ("" disables)
+	spoolMaxBytes        int           // Maximum size of the spool
+	spoolMaxAge          time.Duration // Maximum age of a spooled message
+	encoder              codec.Encoder // Encoder for the readings
+	haDiscovery          bool          // If true then Home Assistant discovery messages are published
+	haDiscoveryPrefix    string        // Home Assistant discovery topic prefix
+	haNodeID             string        // Node id used in the Home Assistant discovery topics
 	printMessage         bool          // If true then published messages will be written to the console
 	debug                bool          // autopaho and paho debug output requested
+
+	probeDeadbands map[onewire.Address]float64 // Change required before a given probe is published again
+
+	sensors ds18b20.Config // sensor backend settings
+}
+
+// requiredKeys must be set, in the environment or the configuration file; they have no default. getConfig reports
+// every one of them that is blank.
+var requiredKeys = []string{envServerURL, envClientID, envTopic}
+
+// configDefaults holds the value used for every other key when it is set neither in the environment nor in the
+// configuration file. A blank default leaves the feature off, or lets getConfig derive the value from other keys.
+var configDefaults = map[string]string{
+	envCAFile:   "",
+	envUsername: "", // the broker is connected to anonymously
+	envPassword: "",
+	envQos:      "1",
+
+	envTopicTemplate: defaultTopicTemplate,
+	envSite:          "",
+	envStatusTopic:   "", // <topic>/status
+
+	envKeepAlive:            "30",
+	envConnectRetryDely:     "10000",
+	envDelayBetweenMessages: "10000",
+	envDrainTimeout:         "5000",
+	envRescanInterval:       "60000",
+	envSensorRetryDelay:     "1000",
+	envSensorRetryMaxDelay:  "60000",
+
+	envBatch:      "false",
+	envBatchTopic: "", // <topic>/batch
+
+	envAggregateWindow: "0",
+
+	envDeadband:       "0",
+	envMaxSilence:     "0",
+	envProbeDeadbands: "",
+
+	envPublishWorkers:    "4",
+	envPublishQueueDepth: "100",
+	envPublishDropPolicy: string(dropNone),
+
+	envSpoolDir:      "",
+	envSpoolMaxBytes: strconv.Itoa(10 << 20),
+	envSpoolMaxAge:   "86400000",
+
+	envEncoding: codec.NameJSON,
+
+	envHADiscovery:       "false",
+	envHADiscoveryPrefix: "homeassistant",
+	envHANodeID:          "", // the client id
+
+	envPrintMessages: "false",
+	envDebug:         "false",
+
+	envSensorBackend:     "", // netlink
+	envSysfsRoot:         "",
+	envBuses:             "",
+	envResolution:        "0",
+	envAllow:             "",
+	envDeny:              "",
+	envReadTimeout:       milliSeconds(ds18b20.DefaultRetry.Timeout),
+	envReadMaxAttempts:   strconv.Itoa(ds18b20.DefaultRetry.MaxAttempts),
+	envReadRetryDelay:    milliSeconds(ds18b20.DefaultRetry.Backoff.Base),
+	envReadRetryMaxDelay: milliSeconds(ds18b20.DefaultRetry.Backoff.Max),
+	envCalibration:       "",
+	envAliases:           "",
+	envSimProbes:         "1",
+	envSimAddrs:          "",
+	envSimBaseline:       "25",
+	envSimDrift:          "0",
+	envSimNoise:          "0",
+	envSimFailureRate:    "0",
+}
+
+// milliSeconds formats d the way durations are written in the environment
+func milliSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
+
+// configErrors lists every missing or invalid key found whilst retrieving the configuration
+type configErrors []error
+
+// add records err unless it is nil; the errors of a nested list are added one by one
+func (es *configErrors) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case configErrors:
+		*es = append(*es, err...)
+	default:
+		*es = append(*es, err)
+	}
+}
+
+func (es configErrors) Error() string {
+	ss := make([]string, 0, len(es))
+	for _, err := range es {
+		ss = append(ss, err.Error())
+	}
+	return strings.Join(ss, "; ")
 }
 
-// getConfig - Retrieves the configuration from the environment
+// err returns the list as an error, nil if it is empty
+func (es configErrors) err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// getConfig - Retrieves the configuration from the environment, reporting every missing or invalid key at once
 func getConfig() (config, error) {
 	var cfg config
+	var errs configErrors
 	var err error
 
-	srvURL, err := requiredStringFromEnv(envServerURL)
-	if err != nil {
-		return config{}, err
+	missing := map[string]bool{}
+	for _, k := range requiredKeys {
+		if _, err := requiredStringFromEnv(k); err != nil {
+			errs.add(err)
+			missing[k] = true
+		}
 	}
-	cfg.serverURL, err = url.Parse(srvURL)
-	if err != nil {
-		return config{}, fmt.Errorf("environmental variable %s must be a valid URL (%w)", envServerURL, err)
+
+	if !missing[envServerURL] {
+		cfg.serverURLs, err = urlsFromEnv(envServerURL)
+		errs.add(err)
+		for _, u := range cfg.serverURLs {
+			errs.add(validateBrokerURL(envServerURL, u))
+		}
 	}
 
 	cfg.caFile = stringFromEnv(envCAFile)
 
-	if cfg.clientID, err = requiredStringFromEnv(envClientID); err != nil {
-		return config{}, err
-	}
-	if cfg.username, err = requiredStringFromEnv(envUsername); err != nil {
-		return config{}, err
-	}
-	if cfg.password, err = requiredStringFromEnv(envPassword); err != nil {
-		return config{}, err
+	cfg.clientID = getenv(envClientID)
+	cfg.username = stringFromEnv(envUsername)
+	cfg.password = getenv(envPassword)
+
+	if cfg.topic = getenv(envTopic); !missing[envTopic] {
+		if err := topic.Validate(cfg.topic); err != nil {
+			errs.add(fmt.Errorf("environmental variable %s must be a valid publish topic (%w)", envTopic, err))
+		}
 	}
-	if cfg.topic, err = requiredStringFromEnv(envTopic); err != nil {
-		return config{}, err
+
+	cfg.topicTemplate, err = topicTemplateFromEnv(envTopicTemplate, defaultTopicTemplate)
+	errs.add(err)
+	cfg.site = stringFromEnv(envSite)
+
+	cfg.statusTopic, err = topicFromEnv(envStatusTopic, defaultStatusTopic(cfg.topic))
+	errs.add(err)
+
+	iQos, err := intRangeFromEnv(envQos, 0, 2)
+	errs.add(err)
+	cfg.qos = byte(iQos)
+
+	iKa, err := intRangeFromEnv(envKeepAlive, 0, math.MaxUint16)
+	errs.add(err)
+	cfg.keepAlive = uint16(iKa)
+
+	cfg.connectRetryDelay, err = positiveMilliSecondsFromEnv(envConnectRetryDely)
+	errs.add(err)
+	cfg.delayBetweenMessages, err = positiveMilliSecondsFromEnv(envDelayBetweenMessages)
+	errs.add(err)
+	cfg.drainTimeout, err = positiveMilliSecondsFromEnv(envDrainTimeout)
+	errs.add(err)
+	cfg.rescanInterval, err = milliSecondsFromEnv(envRescanInterval)
+	errs.add(err)
+	cfg.sensorRetryDelay, err = positiveMilliSecondsFromEnv(envSensorRetryDelay)
+	errs.add(err)
+	cfg.sensorRetryMaxDelay, err = milliSecondsFromEnv(envSensorRetryMaxDelay)
+	errs.add(err)
+
+	cfg.batch, err = booleanFromEnv(envBatch)
+	errs.add(err)
+	if cfg.batch {
+		cfg.batchTopic, err = topicFromEnv(envBatchTopic, defaultBatchTopic(cfg.topic))
+		errs.add(err)
 	}
 
-	iQos, err := intFromEnv(envQos)
-	if err != nil {
-		return config{}, err
+	cfg.aggregateWindow, err = milliSecondsFromEnv(envAggregateWindow)
+	errs.add(err)
+
+	if cfg.deadband, err = floatFromEnv(envDeadband); err == nil && cfg.deadband < 0 {
+		err = fmt.Errorf("environmental variable %s must not be negative (is %v)", envDeadband, cfg.deadband)
 	}
-	cfg.qos = byte(iQos)
+	errs.add(err)
+	cfg.probeDeadbands, err = probeDeadbandsFromEnv(envProbeDeadbands)
+	errs.add(err)
+	cfg.maxSilence, err = milliSecondsFromEnv(envMaxSilence)
+	errs.add(err)
 
-	iKa, err := intFromEnv(envKeepAlive)
-	if err != nil {
-		return config{}, err
+	if cfg.publishWorkers, err = intFromEnv(envPublishWorkers); err == nil && cfg.publishWorkers < 1 {
+		err = fmt.Errorf("environmental variable %s must be at least 1 (is %d)", envPublishWorkers, cfg.publishWorkers)
 	}
-	cfg.keepAlive = uint16(iKa)
+	errs.add(err)
+	if cfg.publishQueueDepth, err = intFromEnv(envPublishQueueDepth); err == nil && cfg.publishQueueDepth < 1 {
+		err = fmt.Errorf("environmental variable %s must be at least 1 (is %d)", envPublishQueueDepth, cfg.publishQueueDepth)
+	}
+	errs.add(err)
+	cfg.publishDropPolicy, err = dropPolicyFromEnv(envPublishDropPolicy)
+	errs.add(err)
 
-	if cfg.connectRetryDelay, err = milliSecondsFromEnv(envConnectRetryDely); err != nil {
-		return config{}, err
+	cfg.spoolDir = stringFromEnv(envSpoolDir)
+	cfg.spoolMaxBytes, err = intRangeFromEnv(envSpoolMaxBytes, 0, math.MaxInt)
+	errs.add(err)
+	cfg.spoolMaxAge, err = milliSecondsFromEnv(envSpoolMaxAge)
+	errs.add(err)
+
+	cfg.encoder, err = encoderFromEnv(envEncoding)
+	errs.add(err)
+
+	cfg.haDiscovery, err = booleanFromEnv(envHADiscovery)
+	errs.add(err)
+	if cfg.haDiscovery {
+		// Discovery points Home Assistant at the per-probe topics, which nothing is published on in batch mode
+		if cfg.batch {
+			errs.add(fmt.Errorf("environmental variable %s must not be set together with %s", envHADiscovery, envBatch))
+		}
+		if cfg.encoder != nil {
+			if _, ok := haValueTemplates[cfg.encoder.ContentType()]; !ok {
+				errs.add(fmt.Errorf("environmental variable %s requires %s to be %s or %s", envHADiscovery, envEncoding, codec.NameJSON, codec.NameSenML))
+			}
+		}
+		cfg.haDiscoveryPrefix, err = topicFromEnv(envHADiscoveryPrefix, "")
+		errs.add(err)
+		if cfg.haNodeID = stringFromEnv(envHANodeID); cfg.haNodeID == "" {
+			cfg.haNodeID = haNodeID(cfg.clientID)
+		}
+		if cfg.haNodeID != haNodeID(cfg.haNodeID) {
+			errs.add(fmt.Errorf("environmental variable %s must only contain letters, digits, _ and - (is %s)", envHANodeID, cfg.haNodeID))
+		}
 	}
 
-	if cfg.delayBetweenMessages, err = milliSecondsFromEnv(envDelayBetweenMessages); err != nil {
+	cfg.printMessage, err = booleanFromEnv(envPrintMessages)
+	errs.add(err)
+	cfg.debug, err = booleanFromEnv(envDebug)
+	errs.add(err)
+
+	cfg.sensors, err = sensorsFromEnv()
+	errs.add(err)
+
+	if err := errs.err(); err != nil {
 		return config{}, err
 	}
+	return cfg, nil
+}
 
-	if cfg.printMessage, err = booleanFromEnv(envPrintMessages); err != nil {
-		return config{}, err
+// sensorsFromEnv - Retrieves the ds18b20 backend settings from the environment, reporting every invalid key at once
+func sensorsFromEnv() (ds18b20.Config, error) {
+	var sc ds18b20.Config
+	var errs configErrors
+	var err error
+
+	sc.Buses, err = intsFromEnv(envBuses)
+	errs.add(err)
+	sc.Resolution, err = intFromEnv(envResolution)
+	errs.add(err)
+	sc.Retry, err = retryPolicyFromEnv()
+	errs.add(err)
+	sc.Allow, err = addressesFromEnv(envAllow)
+	errs.add(err)
+	sc.Deny, err = addressesFromEnv(envDeny)
+	errs.add(err)
+	sc.Calibration, err = calibrationFromEnv(envCalibration)
+	errs.add(err)
+	sc.Meta, err = aliasesFromEnv(envAliases)
+	errs.add(err)
+
+	sc.Backend = ds18b20.Backend(stringFromEnv(envSensorBackend))
+	switch sc.Backend {
+	case "", ds18b20.BackendNetlink:
+	case ds18b20.BackendSysfs:
+		sc.SysfsRoot = stringFromEnv(envSysfsRoot)
+	case ds18b20.BackendSim:
+		sc.Sim.Probes, err = intFromEnv(envSimProbes)
+		errs.add(err)
+		sc.Sim.Addrs, err = addressesFromEnv(envSimAddrs)
+		errs.add(err)
+		sc.Sim.Baseline, err = floatFromEnv(envSimBaseline)
+		errs.add(err)
+		sc.Sim.Drift, err = floatFromEnv(envSimDrift)
+		errs.add(err)
+		sc.Sim.Noise, err = floatFromEnv(envSimNoise)
+		errs.add(err)
+		sc.Sim.FailureRate, err = floatRangeFromEnv(envSimFailureRate, 0, 1)
+		errs.add(err)
+	default:
+		errs.add(fmt.Errorf("environmental variable %s must be one of %s, %s, %s (is %s)", envSensorBackend, ds18b20.BackendNetlink, ds18b20.BackendSysfs, ds18b20.BackendSim, sc.Backend))
 	}
+	// Checked here too so that check-config rejects what Open would
+	errs.add(sc.Validate())
 
-	if cfg.debug, err = booleanFromEnv(envDebug); err != nil {
-		return config{}, err
+	if err := errs.err(); err != nil {
+		return ds18b20.Config{}, err
 	}
+	return sc, nil
+}
 
-	return cfg, nil
+// retryPolicyFromEnv - Retrieves the timeout and retries of probe reads from the environment
+func retryPolicyFromEnv() (ds18b20.RetryPolicy, error) {
+	var p ds18b20.RetryPolicy
+	var errs configErrors
+	var err error
+
+	p.Timeout, err = milliSecondsFromEnv(envReadTimeout)
+	errs.add(err)
+	p.MaxAttempts, err = intFromEnv(envReadMaxAttempts)
+	errs.add(err)
+	p.Backoff.Base, err = positiveMilliSecondsFromEnv(envReadRetryDelay)
+	errs.add(err)
+	p.Backoff.Max, err = milliSecondsFromEnv(envReadRetryMaxDelay)
+	errs.add(err)
+
+	if err := errs.err(); err != nil {
+		return ds18b20.RetryPolicy{}, err
+	}
+	return p, nil
 }
 
 // stringFromEnv gets a string from the environment or returns an empty string if not set.
 func stringFromEnv(key string) string {
-	return strings.TrimSpace(os.Getenv(key))
+	return strings.TrimSpace(getenv(key))
 }
 
 // requiredStringFromEnv - Retrieves a string from the environment and ensures it is not blank (ort non-existent)
 func requiredStringFromEnv(key string) (string, error) {
-	s := os.Getenv(key)
+	s := getenv(key)
 	if len(s) == 0 {
 		return "", fmt.Errorf("environmental variable %s must not be blank", key)
 	}
 	return s, nil
 }
 
+// urlsFromEnv - Retrieves a comma separated list of URLs from the environment (must be present and valid)
+func urlsFromEnv(key string) ([]*url.URL, error) {
+	var us []*url.URL
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s must be a valid URL (%w)", key, err)
+		}
+		us = append(us, u)
+	}
+	if len(us) == 0 {
+		return nil, fmt.Errorf("environmental variable %s must not be blank", key)
+	}
+	return us, nil
+}
+
+// brokerSchemes are the URL schemes the MQTT client can connect with
+var brokerSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+// validateBrokerURL ensures u, taken from the environmental variable key, is one the MQTT client can connect to
+func validateBrokerURL(key string, u *url.URL) error {
+	known := false
+	for _, s := range brokerSchemes {
+		if u.Scheme == s {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("environmental variable %s: scheme of %s must be one of %s (is %q)", key, u.Redacted(), strings.Join(brokerSchemes, ", "), u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("environmental variable %s: host of %s must not be blank", key, u.Redacted())
+	}
+	return nil
+}
+
+// intRangeFromEnv - Retrieves an integer between min and max inclusive from the environment (must be present and valid)
+func intRangeFromEnv(key string, min int, max int) (int, error) {
+	i, err := intFromEnv(key)
+	if err != nil {
+		return 0, err
+	}
+	if i < min || i > max {
+		return 0, fmt.Errorf("environmental variable %s must be between %d and %d (is %d)", key, min, max, i)
+	}
+	return i, nil
+}
+
+// floatRangeFromEnv - Retrieves a number from the environment and ensures it is between min and max
+func floatRangeFromEnv(key string, min float64, max float64) (float64, error) {
+	f, err := floatFromEnv(key)
+	if err != nil {
+		return 0, err
+	}
+	if f < min || f > max {
+		return 0, fmt.Errorf("environmental variable %s must be between %g and %g (is %g)", key, min, max, f)
+	}
+	return f, nil
+}
+
 // intFromEnv - Retrieves an integer from the environment (must be present and valid)
 func intFromEnv(key string) (int, error) {
-	s := os.Getenv(key)
+	s := getenv(key)
 	if len(s) == 0 {
 		return 0, fmt.Errorf("environmental variable %s must not be blank", key)
 	}
@@ -133,9 +536,202 @@ func intFromEnv(key string) (int, error) {
 	return i, nil
 }
 
+// floatFromEnv - Retrieves a float from the environment (must be present and valid)
+func floatFromEnv(key string) (float64, error) {
+	s := stringFromEnv(key)
+	if len(s) == 0 {
+		return 0, fmt.Errorf("environmental variable %s must not be blank", key)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("environmental variable %s must be a number", key)
+	}
+	return f, nil
+}
+
+// intsFromEnv - Retrieves a comma separated list of integers from the environment (may be blank)
+func intsFromEnv(key string) ([]int, error) {
+	var is []int
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s must be a list of integers", key)
+		}
+		is = append(is, i)
+	}
+	return is, nil
+}
+
+// addressesFromEnv - Retrieves a comma separated list of 1-wire addresses from the environment (may be blank)
+func addressesFromEnv(key string) ([]onewire.Address, error) {
+	var addrs []onewire.Address
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		a, err := ds18b20.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s: %w", key, err)
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+// calibrationFromEnv - Retrieves a comma separated list of address:offset[:gain] probe corrections
+// from the environment (may be blank)
+func calibrationFromEnv(key string) (map[onewire.Address]ds18b20.Calibration, error) {
+	var cals map[onewire.Address]ds18b20.Calibration
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("environmental variable %s must be a list of address:offset[:gain] (is %s)", key, s)
+		}
+		a, err := ds18b20.ParseAddress(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s: %w", key, err)
+		}
+		var c ds18b20.Calibration
+		if c.Offset, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return nil, fmt.Errorf("environmental variable %s: offset of %s must be a number", key, parts[0])
+		}
+		if len(parts) == 3 {
+			if c.Gain, err = strconv.ParseFloat(parts[2], 64); err != nil {
+				return nil, fmt.Errorf("environmental variable %s: gain of %s must be a number", key, parts[0])
+			}
+			// A zero gain would be taken for no gain at all
+			if c.Gain == 0 {
+				return nil, fmt.Errorf("environmental variable %s: gain of %s must not be 0", key, parts[0])
+			}
+		}
+		if cals == nil {
+			cals = map[onewire.Address]ds18b20.Calibration{}
+		}
+		cals[a] = c
+	}
+	return cals, nil
+}
+
+// aliasesFromEnv - Retrieves a comma separated list of address:alias[:tank[:location]] probe names
+// from the environment (may be blank)
+func aliasesFromEnv(key string) (map[onewire.Address]sensor.Meta, error) {
+	var metas map[onewire.Address]sensor.Meta
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("environmental variable %s must be a list of address:alias[:tank[:location]] (is %s)", key, s)
+		}
+		a, err := ds18b20.ParseAddress(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s: %w", key, err)
+		}
+		m := sensor.Meta{Alias: parts[1]}
+		if len(parts) > 2 {
+			m.Tank = parts[2]
+		}
+		if len(parts) > 3 {
+			m.Location = parts[3]
+		}
+		if metas == nil {
+			metas = map[onewire.Address]sensor.Meta{}
+		}
+		metas[a] = m
+	}
+	return metas, nil
+}
+
+// probeDeadbandsFromEnv - Retrieves a comma separated list of address:delta probe deadbands from the environment
+// (may be blank)
+func probeDeadbandsFromEnv(key string) (map[onewire.Address]float64, error) {
+	var dbs map[onewire.Address]float64
+	for _, s := range strings.Split(stringFromEnv(key), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("environmental variable %s must be a list of address:delta (is %s)", key, s)
+		}
+		a, err := ds18b20.ParseAddress(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("environmental variable %s: %w", key, err)
+		}
+		d, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("environmental variable %s: delta of %s must be a positive number", key, parts[0])
+		}
+		if dbs == nil {
+			dbs = map[onewire.Address]float64{}
+		}
+		dbs[a] = d
+	}
+	return dbs, nil
+}
+
+// topicFromEnv - Retrieves a publish topic from the environment, def if blank
+func topicFromEnv(key string, def string) (string, error) {
+	t := stringFromEnv(key)
+	if t == "" {
+		t = def
+	}
+	if err := topic.Validate(t); err != nil {
+		return "", fmt.Errorf("environmental variable %s must be a valid publish topic (%w)", key, err)
+	}
+	return t, nil
+}
+
+// topicTemplateFromEnv - Retrieves a topic template from the environment, def if blank
+func topicTemplateFromEnv(key string, def string) (topic.Template, error) {
+	s := stringFromEnv(key)
+	if s == "" {
+		s = def
+	}
+	t, err := topic.Parse(s)
+	if err != nil {
+		return topic.Template{}, fmt.Errorf("environmental variable %s must be a valid topic template (%w)", key, err)
+	}
+	return t, nil
+}
+
+// dropPolicyFromEnv - Retrieves the publish queue drop policy from the environment, block if blank
+func dropPolicyFromEnv(key string) (dropPolicy, error) {
+	switch p := dropPolicy(stringFromEnv(key)); p {
+	case "":
+		return dropNone, nil
+	case dropNone, dropOldest, dropNewest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("environmental variable %s must be one of %s, %s, %s (is %s)", key, dropNone, dropOldest, dropNewest, p)
+	}
+}
+
+// encoderFromEnv - Retrieves the payload encoder named in the environment, JSON if blank
+func encoderFromEnv(key string) (codec.Encoder, error) {
+	name := stringFromEnv(key)
+	enc, err := codec.ByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("environmental variable %s must be one of %s (is %s)", key, strings.Join(codec.Names, ", "), name)
+	}
+	return enc, nil
+}
+
 // milliSecondsFromEnv - Retrieves milliseconds (as time.Duration) from the environment (must be present and valid)
 func milliSecondsFromEnv(key string) (time.Duration, error) {
-	s := os.Getenv(key)
+	s := getenv(key)
 	if len(s) == 0 {
 		return 0, fmt.Errorf("environmental valiable %s must not be blank", key)
 	}
@@ -143,12 +739,24 @@ func milliSecondsFromEnv(key string) (time.Duration, error) {
 	if err != nil {
 		return 0, fmt.Errorf("environmental valiable %s must be an integer", key)
 	}
+	if i < 0 {
+		return 0, fmt.Errorf("environmental variable %s must not be negative (is %d)", key, i)
+	}
 	return time.Duration(i) * time.Millisecond, nil
 }
 
+// positiveMilliSecondsFromEnv - Retrieves a number of milliseconds from the environment and ensures it is greater than 0
+func positiveMilliSecondsFromEnv(key string) (time.Duration, error) {
+	d, err := milliSecondsFromEnv(key)
+	if err == nil && d == 0 {
+		return 0, fmt.Errorf("environmental variable %s must be greater than 0", key)
+	}
+	return d, err
+}
+
 // booleanFromEnv - Retrieves boolean from the environment (must be present and valid)
 func booleanFromEnv(key string) (bool, error) {
-	s := os.Getenv(key)
+	s := getenv(key)
 	if len(s) == 0 {
 		return false, fmt.Errorf("environmental variable %s must not be blank", key)
 	}
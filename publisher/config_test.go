@@ -2,9 +2,19 @@ package main
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/lupinthe14th/acm/publisher/backoff"
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/topic"
+	"periph.io/x/conn/v3/onewire"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -22,17 +32,20 @@ func TestGetConfig(t *testing.T) {
 		delayBetweenMessages string
 		printMessages        string
 		debug                string
+		file                 string // contents of the YAML configuration file, if any
 		wantConfig           config
+		env                  map[string]string // other environmental variables
+		wantErrs             []string          // text the error must contain
 		isErr                bool
 	}{
 		{
 			name:                 "standerd case",
-			serverURL:            "http://localhost:1883",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
@@ -40,20 +53,33 @@ func TestGetConfig(t *testing.T) {
 			printMessages:        "true",
 			debug:                "false",
 			wantConfig: config{
-				serverURL: &url.URL{
-					Scheme: "http",
-					Host:   "localhost:1883"},
+				serverURLs: []*url.URL{{
+					Scheme: "mqtt",
+					Host:   "localhost:1883"}},
 				caFile:               "ca.pem",
 				clientID:             "publisher00001",
 				username:             "user",
 				password:             "pass",
-				topic:                "/example/#",
+				topic:                "/example/sensors",
 				qos:                  byte(0),
+				topicTemplate:        defaultTemplate(t),
+				statusTopic:          "/example/sensors/status",
 				keepAlive:            30,
 				connectRetryDelay:    time.Duration(30) * time.Millisecond,
 				delayBetweenMessages: time.Duration(15) * time.Millisecond,
+				drainTimeout:         5 * time.Second,
+				rescanInterval:       time.Minute,
+				sensorRetryDelay:     time.Second,
+				sensorRetryMaxDelay:  time.Minute,
+				publishWorkers:       4,
+				publishQueueDepth:    100,
+				publishDropPolicy:    dropNone,
+				spoolMaxBytes:        10 << 20,
+				spoolMaxAge:          24 * time.Hour,
+				encoder:              codec.JSON{},
 				printMessage:         true,
 				debug:                false,
+				sensors:              ds18b20.Config{Retry: ds18b20.DefaultRetry},
 			},
 			isErr: false,
 		},
@@ -64,7 +90,7 @@ func TestGetConfig(t *testing.T) {
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
@@ -81,7 +107,7 @@ func TestGetConfig(t *testing.T) {
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
@@ -93,12 +119,12 @@ func TestGetConfig(t *testing.T) {
 		},
 		{
 			name:                 "caFile must be a blank case",
-			serverURL:            "http://localhost:1883",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
@@ -106,31 +132,44 @@ func TestGetConfig(t *testing.T) {
 			printMessages:        "true",
 			debug:                "false",
 			wantConfig: config{
-				serverURL: &url.URL{
-					Scheme: "http",
-					Host:   "localhost:1883"},
+				serverURLs: []*url.URL{{
+					Scheme: "mqtt",
+					Host:   "localhost:1883"}},
 				caFile:               "",
 				clientID:             "publisher00001",
 				username:             "user",
 				password:             "pass",
-				topic:                "/example/#",
+				topic:                "/example/sensors",
 				qos:                  byte(0),
+				topicTemplate:        defaultTemplate(t),
+				statusTopic:          "/example/sensors/status",
 				keepAlive:            30,
 				connectRetryDelay:    time.Duration(30) * time.Millisecond,
 				delayBetweenMessages: time.Duration(15) * time.Millisecond,
+				drainTimeout:         5 * time.Second,
+				rescanInterval:       time.Minute,
+				sensorRetryDelay:     time.Second,
+				sensorRetryMaxDelay:  time.Minute,
+				publishWorkers:       4,
+				publishQueueDepth:    100,
+				publishDropPolicy:    dropNone,
+				spoolMaxBytes:        10 << 20,
+				spoolMaxAge:          24 * time.Hour,
+				encoder:              codec.JSON{},
 				printMessage:         true,
 				debug:                false,
+				sensors:              ds18b20.Config{Retry: ds18b20.DefaultRetry},
 			},
 			isErr: false,
 		},
 		{
 			name:                 "clientID must not be blank case",
-			serverURL:            "http://localhost:1883",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
@@ -142,7 +181,7 @@ func TestGetConfig(t *testing.T) {
 		},
 		{
 			name:                 "topic must not be blank case",
-			serverURL:            "http://localhost:1883",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
@@ -158,14 +197,14 @@ func TestGetConfig(t *testing.T) {
 			isErr:                true,
 		},
 		{
-			name:                 "qos must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "topic must not contain wildcards case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
 			topic:                "/example/#",
-			qos:                  "",
+			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
 			delayBetweenMessages: "15",
@@ -175,90 +214,476 @@ func TestGetConfig(t *testing.T) {
 			isErr:                true,
 		},
 		{
-			name:                 "keepAlive must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "qos default case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
+			qos:                  "",
+			keepAlive:            "30",
+			connectRetryDelay:    "30",
+			delayBetweenMessages: "15",
+			printMessages:        "true",
+			debug:                "false",
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.qos = 1
+				return c
+			}(),
+			isErr: false,
+		},
+		{
+			name:                 "keepAlive default case",
+			serverURL:            "mqtt://localhost:1883",
+			caFile:               "ca.pem",
+			clientID:             "publisher00001",
+			username:             "user",
+			password:             "pass",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "",
 			connectRetryDelay:    "30",
 			delayBetweenMessages: "15",
 			printMessages:        "true",
 			debug:                "false",
-			wantConfig:           config{},
-			isErr:                true,
+			wantConfig:           standardConfig(t),
+			isErr:                false,
 		},
 		{
-			name:                 "connectRetryDelay  must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "connectRetryDelay default case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "",
 			delayBetweenMessages: "15",
 			printMessages:        "true",
 			debug:                "false",
-			wantConfig:           config{},
-			isErr:                true,
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.connectRetryDelay = 10 * time.Second
+				return c
+			}(),
+			isErr: false,
 		},
 		{
-			name:                 "delayBetweenMessages must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "delayBetweenMessages default case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
 			delayBetweenMessages: "",
 			printMessages:        "true",
 			debug:                "false",
-			wantConfig:           config{},
-			isErr:                true,
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.delayBetweenMessages = 10 * time.Second
+				return c
+			}(),
+			isErr: false,
 		},
 		{
-			name:                 "printMessages must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "printMessages default case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
 			delayBetweenMessages: "15",
 			printMessages:        "",
 			debug:                "false",
-			wantConfig:           config{},
-			isErr:                true,
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.printMessage = false
+				return c
+			}(),
+			isErr: false,
 		},
 		{
-			name:                 "debug must not be blank case",
-			serverURL:            "http://localhost:1883",
+			name:                 "debug default case",
+			serverURL:            "mqtt://localhost:1883",
 			caFile:               "ca.pem",
 			clientID:             "publisher00001",
 			username:             "user",
 			password:             "pass",
-			topic:                "/example/#",
+			topic:                "/example/sensors",
 			qos:                  "0",
 			keepAlive:            "30",
 			connectRetryDelay:    "30",
 			delayBetweenMessages: "15",
 			printMessages:        "true",
 			debug:                "",
+			wantConfig:           standardConfig(t),
+			isErr:                false,
+		},
+		{
+			name: "config file case",
+			file: `
+brokers:
+  - mqtts://broker1.example.com:8883
+  - mqtts://broker2.example.com:8883
+clientID: publisher00001
+username: user
+password: pass
+topic: /example/sensors
+qos: 1
+keepAlive: 30
+connectRetryDelay: 30
+delayBetweenMessages: 15
+printMessages: false
+debug: false
+buses: [1, 2]
+probes:
+  - address: "293ce10457784c28"
+    alias: sump
+    tank: display
+    offset: -0.25
+    deadband: 0.05
+  - address: "28ff641d8f16043b"
+    gain: 1.01
+`,
+			wantConfig: config{
+				serverURLs: []*url.URL{
+					{Scheme: "mqtts", Host: "broker1.example.com:8883"},
+					{Scheme: "mqtts", Host: "broker2.example.com:8883"}},
+				clientID:             "publisher00001",
+				username:             "user",
+				password:             "pass",
+				topic:                "/example/sensors",
+				qos:                  byte(1),
+				topicTemplate:        defaultTemplate(t),
+				statusTopic:          "/example/sensors/status",
+				keepAlive:            30,
+				connectRetryDelay:    time.Duration(30) * time.Millisecond,
+				delayBetweenMessages: time.Duration(15) * time.Millisecond,
+				drainTimeout:         5 * time.Second,
+				rescanInterval:       time.Minute,
+				sensorRetryDelay:     time.Second,
+				sensorRetryMaxDelay:  time.Minute,
+				publishWorkers:       4,
+				publishQueueDepth:    100,
+				publishDropPolicy:    dropNone,
+				spoolMaxBytes:        10 << 20,
+				spoolMaxAge:          24 * time.Hour,
+				encoder:              codec.JSON{},
+				probeDeadbands:       map[onewire.Address]float64{0x293ce10457784c28: 0.05},
+				sensors: ds18b20.Config{
+					Buses: []int{1, 2},
+					Retry: ds18b20.DefaultRetry,
+					Calibration: map[onewire.Address]ds18b20.Calibration{
+						0x293ce10457784c28: {Offset: -0.25},
+						0x28ff641d8f16043b: {Gain: 1.01},
+					},
+					Meta: map[onewire.Address]sensor.Meta{0x293ce10457784c28: {Alias: "sump", Tank: "display"}},
+				},
+			},
+			isErr: false,
+		},
+		{
+			name:                 "environment overrides config file case",
+			serverURL:            "mqtt://localhost:1883",
+			caFile:               "ca.pem",
+			clientID:             "publisher00001",
+			username:             "user",
+			password:             "pass",
+			topic:                "/example/sensors",
+			qos:                  "0",
+			keepAlive:            "30",
+			connectRetryDelay:    "30",
+			delayBetweenMessages: "15",
+			printMessages:        "true",
+			debug:                "false",
+			file: `
+serverURL: mqtt://broker.example.com:1883
+clientID: other
+topic: /other/sensors
+qos: 2
+site: home
+`,
+			wantConfig: config{
+				serverURLs: []*url.URL{{
+					Scheme: "mqtt",
+					Host:   "localhost:1883"}},
+				caFile:               "ca.pem",
+				clientID:             "publisher00001",
+				username:             "user",
+				password:             "pass",
+				topic:                "/example/sensors",
+				qos:                  byte(0),
+				topicTemplate:        defaultTemplate(t),
+				site:                 "home",
+				statusTopic:          "/example/sensors/status",
+				keepAlive:            30,
+				connectRetryDelay:    time.Duration(30) * time.Millisecond,
+				delayBetweenMessages: time.Duration(15) * time.Millisecond,
+				drainTimeout:         5 * time.Second,
+				rescanInterval:       time.Minute,
+				sensorRetryDelay:     time.Second,
+				sensorRetryMaxDelay:  time.Minute,
+				publishWorkers:       4,
+				publishQueueDepth:    100,
+				publishDropPolicy:    dropNone,
+				spoolMaxBytes:        10 << 20,
+				spoolMaxAge:          24 * time.Hour,
+				encoder:              codec.JSON{},
+				printMessage:         true,
+				debug:                false,
+				sensors:              ds18b20.Config{Retry: ds18b20.DefaultRetry},
+			},
+			isErr: false,
+		},
+		{
+			name:                 "username may be blank case",
+			serverURL:            "mqtt://localhost:1883",
+			caFile:               "ca.pem",
+			clientID:             "publisher00001",
+			username:             "",
+			password:             "pass",
+			topic:                "/example/sensors",
+			qos:                  "0",
+			keepAlive:            "30",
+			connectRetryDelay:    "30",
+			delayBetweenMessages: "15",
+			printMessages:        "true",
+			debug:                "false",
+			file:                 "clientID: other\n",
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.username = ""
+				return c
+			}(),
+			isErr: false,
+		},
+		{
+			name:                 "every missing or invalid key is reported case",
+			serverURL:            "",
+			clientID:             "",
+			topic:                "",
+			qos:                  "x",
+			keepAlive:            "30",
+			connectRetryDelay:    "30",
+			delayBetweenMessages: "15",
+			printMessages:        "maybe",
+			wantConfig:           config{},
+			wantErrs:             []string{envServerURL, envClientID, envTopic, envQos, envPrintMessages},
+			isErr:                true,
+		},
+		{
+			name:       "qos must be between 0 and 2 case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			qos:        "7",
+			wantConfig: config{},
+			wantErrs:   []string{envQos, "between 0 and 2"},
+			isErr:      true,
+		},
+		{
+			name:       "keepAlive must not be negative case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			keepAlive:  "-1",
+			wantConfig: config{},
+			wantErrs:   []string{envKeepAlive, "between 0 and 65535"},
+			isErr:      true,
+		},
+		{
+			name:       "keepAlive must fit in 16 bits case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			keepAlive:  "65536",
+			wantConfig: config{},
+			wantErrs:   []string{envKeepAlive, "between 0 and 65535"},
+			isErr:      true,
+		},
+		{
+			name:              "connectRetryDelay must not be negative case",
+			serverURL:         "mqtt://localhost:1883",
+			clientID:          "publisher00001",
+			topic:             "/example/sensors",
+			connectRetryDelay: "-5",
+			wantConfig:        config{},
+			wantErrs:          []string{envConnectRetryDely, "negative"},
+			isErr:             true,
+		},
+		{
+			name:                 "delayBetweenMessages must not be zero case",
+			serverURL:            "mqtt://localhost:1883",
+			clientID:             "publisher00001",
+			topic:                "/example/sensors",
+			delayBetweenMessages: "0",
 			wantConfig:           config{},
+			wantErrs:             []string{envDelayBetweenMessages, "greater than 0"},
 			isErr:                true,
 		},
+		{
+			name:       "serverURL must use an MQTT scheme case",
+			serverURL:  "http://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			wantConfig: config{},
+			wantErrs:   []string{envServerURL, "scheme"},
+			isErr:      true,
+		},
+		{
+			name:       "serverURL must have a host case",
+			serverURL:  "mqtt://:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			wantConfig: config{},
+			wantErrs:   []string{envServerURL, "host"},
+			isErr:      true,
+		},
+		{
+			name:       "every serverURL is validated case",
+			serverURL:  "mqtts://broker.example.com:8883,https://broker.example.com",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			wantConfig: config{},
+			wantErrs:   []string{envServerURL, "https"},
+			isErr:      true,
+		},
+		{
+			name:                 "websocket serverURLs case",
+			serverURL:            "wss://broker.example.com:8084/mqtt, ws://localhost:8083/mqtt",
+			caFile:               "ca.pem",
+			clientID:             "publisher00001",
+			username:             "user",
+			password:             "pass",
+			topic:                "/example/sensors",
+			qos:                  "2",
+			keepAlive:            "0",
+			connectRetryDelay:    "30",
+			delayBetweenMessages: "15",
+			printMessages:        "true",
+			wantConfig: func() config {
+				c := standardConfig(t)
+				c.serverURLs = []*url.URL{
+					{Scheme: "wss", Host: "broker.example.com:8084", Path: "/mqtt"},
+					{Scheme: "ws", Host: "localhost:8083", Path: "/mqtt"}}
+				c.qos = 2
+				c.keepAlive = 0
+				return c
+			}(),
+			isErr: false,
+		},
+		{
+			name:       "batch and Home Assistant discovery case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envBatch: "true", envHADiscovery: "true"},
+			wantConfig: config{},
+			wantErrs:   []string{envHADiscovery, envBatch},
+			isErr:      true,
+		},
+		{
+			name:       "resolution must be between 9 and 12 bits case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envResolution: "13"},
+			wantConfig: config{},
+			wantErrs:   []string{"resolution"},
+			isErr:      true,
+		},
+		{
+			name:       "bus numbers must not be negative case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envBuses: "-1"},
+			wantConfig: config{},
+			wantErrs:   []string{"bus"},
+			isErr:      true,
+		},
+		{
+			name:       "readMaxAttempts must not be negative case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envReadMaxAttempts: "-3"},
+			wantConfig: config{},
+			wantErrs:   []string{"attempts"},
+			isErr:      true,
+		},
+		{
+			name:       "alias must not contain a topic separator case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envAliases: "293ce10457784c28:sump/left"},
+			wantConfig: config{},
+			wantErrs:   []string{"alias"},
+			isErr:      true,
+		},
+		{
+			name:       "simFailureRate must be between 0 and 1 case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envSensorBackend: "sim", envSimFailureRate: "5"},
+			wantConfig: config{},
+			wantErrs:   []string{envSimFailureRate},
+			isErr:      true,
+		},
+		{
+			name:       "spoolMaxBytes must not be negative case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envSpoolMaxBytes: "-1"},
+			wantConfig: config{},
+			wantErrs:   []string{envSpoolMaxBytes},
+			isErr:      true,
+		},
+		{
+			name:       "drainTimeout must not be zero case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envDrainTimeout: "0"},
+			wantConfig: config{},
+			wantErrs:   []string{envDrainTimeout, "greater than 0"},
+			isErr:      true,
+		},
+		{
+			name:       "sensorRetryDelay must not be zero case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envSensorRetryDelay: "0"},
+			wantConfig: config{},
+			wantErrs:   []string{envSensorRetryDelay, "greater than 0"},
+			isErr:      true,
+		},
+		{
+			name:       "readRetryDelay must not be zero case",
+			serverURL:  "mqtt://localhost:1883",
+			clientID:   "publisher00001",
+			topic:      "/example/sensors",
+			env:        map[string]string{envReadRetryDelay: "0"},
+			wantConfig: config{},
+			wantErrs:   []string{envReadRetryDelay, "greater than 0"},
+			isErr:      true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -275,6 +700,10 @@ func TestGetConfig(t *testing.T) {
 			t.Setenv("acm_delayBetweenMessages", tt.delayBetweenMessages)
 			t.Setenv("acm_printMessages", tt.printMessages)
 			t.Setenv("acm_debug", tt.debug)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fileConfig = writeConfigFile(t, "acm.yaml", tt.file)
 			got, err := getConfig()
 			if !reflect.DeepEqual(got, tt.wantConfig) {
 				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantConfig)
@@ -282,6 +711,156 @@ func TestGetConfig(t *testing.T) {
 			if tt.isErr && err == nil {
 				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
 			}
+			for _, w := range tt.wantErrs {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("unexpected error: got: %v, want it to contain %s", err, w)
+				}
+			}
+		})
+	}
+}
+
+// standardConfig returns the configuration of the standard case of TestGetConfig
+func standardConfig(t *testing.T) config {
+	return config{
+		serverURLs: []*url.URL{{
+			Scheme: "mqtt",
+			Host:   "localhost:1883"}},
+		caFile:               "ca.pem",
+		clientID:             "publisher00001",
+		username:             "user",
+		password:             "pass",
+		topic:                "/example/sensors",
+		qos:                  byte(0),
+		topicTemplate:        defaultTemplate(t),
+		statusTopic:          "/example/sensors/status",
+		keepAlive:            30,
+		connectRetryDelay:    time.Duration(30) * time.Millisecond,
+		delayBetweenMessages: time.Duration(15) * time.Millisecond,
+		drainTimeout:         5 * time.Second,
+		rescanInterval:       time.Minute,
+		sensorRetryDelay:     time.Second,
+		sensorRetryMaxDelay:  time.Minute,
+		publishWorkers:       4,
+		publishQueueDepth:    100,
+		publishDropPolicy:    dropNone,
+		spoolMaxBytes:        10 << 20,
+		spoolMaxAge:          24 * time.Hour,
+		encoder:              codec.JSON{},
+		printMessage:         true,
+		debug:                false,
+		sensors:              ds18b20.Config{Retry: ds18b20.DefaultRetry},
+	}
+}
+
+func TestGetConfigRequiredKeys(t *testing.T) {
+	t.Setenv(envServerURL, "mqtt://localhost:1883")
+	t.Setenv(envClientID, "publisher00001")
+	t.Setenv(envTopic, "/example/sensors")
+	t.Setenv(envSite, "")
+	fileConfig = nil
+
+	if _, err := getConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Declaring a key required is enough for it to be enforced
+	keys := requiredKeys
+	t.Cleanup(func() { requiredKeys = keys })
+	requiredKeys = append(append([]string{}, keys...), envSite)
+	_, err := getConfig()
+	if err == nil || !strings.Contains(err.Error(), envSite) {
+		t.Errorf("unexpected error: got: %v, want: %s must not be blank", err, envSite)
+	}
+}
+
+func TestIntRangeFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue int
+		isErr     bool
+	}{
+		{name: "lower bound case", value: "0", wantValue: 0},
+		{name: "upper bound case", value: "2", wantValue: 2},
+		{name: "below range case", value: "-1", isErr: true},
+		{name: "above range case", value: "3", isErr: true},
+		{name: "must not be blank case", value: "", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("smallpox", tt.value)
+			got, err := intRangeFromEnv("smallpox", 0, 2)
+			if got != tt.wantValue {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr != (err != nil) {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestFloatRangeFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue float64
+		isErr     bool
+	}{
+		{name: "lower bound case", value: "0", wantValue: 0},
+		{name: "upper bound case", value: "1", wantValue: 1},
+		{name: "in range case", value: "0.25", wantValue: 0.25},
+		{name: "below range case", value: "-0.5", isErr: true},
+		{name: "above range case", value: "5", isErr: true},
+		{name: "must not be blank case", value: "", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("smallpox", tt.value)
+			got, err := floatRangeFromEnv("smallpox", 0, 1)
+			if got != tt.wantValue {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr != (err != nil) {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestValidateBrokerURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		isErr bool
+	}{
+		{name: "tcp case", url: "tcp://localhost:1883"},
+		{name: "mqtt case", url: "mqtt://localhost:1883"},
+		{name: "ssl case", url: "ssl://broker.example.com:8883"},
+		{name: "tls case", url: "tls://broker.example.com:8883"},
+		{name: "mqtts case", url: "mqtts://broker.example.com:8883"},
+		{name: "ws case", url: "ws://broker.example.com:8083/mqtt"},
+		{name: "wss case", url: "wss://broker.example.com:8084/mqtt"},
+		{name: "upper case scheme case", url: "MQTT://localhost:1883"},
+		{name: "http case", url: "http://localhost:1883", isErr: true},
+		{name: "no scheme case", url: "localhost:1883", isErr: true},
+		{name: "no host case", url: "mqtt:///sensors", isErr: true},
+		{name: "port only case", url: "mqtt://:1883", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = validateBrokerURL(envServerURL, u)
+			if tt.isErr != (err != nil) {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
 		})
 	}
 }
@@ -430,6 +1009,13 @@ func TestMillSeconfFromEnv(t *testing.T) {
 			wantValue: 0,
 			isErr:     false,
 		},
+		{
+			name:      "must not be negative",
+			key:       "smallpox",
+			value:     "-1",
+			wantValue: 0,
+			isErr:     true,
+		},
 		{
 			name:      "must not be blank",
 			key:       "smallpox",
@@ -459,6 +1045,52 @@ func TestMillSeconfFromEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestPositiveMilliSecondsFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		wantValue time.Duration
+		isErr     bool
+	}{
+		{
+			name:      "get value: standerd case",
+			key:       "smallpox",
+			value:     "1",
+			wantValue: time.Duration(1) * time.Millisecond,
+			isErr:     false,
+		},
+		{
+			name:      "must not be zero",
+			key:       "smallpox",
+			value:     "0",
+			wantValue: 0,
+			isErr:     true,
+		},
+		{
+			name:      "must not be negative",
+			key:       "smallpox",
+			value:     "-1",
+			wantValue: 0,
+			isErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			got, err := positiveMilliSecondsFromEnv(tt.key)
+			if got != tt.wantValue {
+				t.Fatalf("unexpected value: got: %d, want: %d", got, tt.wantValue)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
 func TestBoolFromEnv(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -566,3 +1198,561 @@ func TestBoolFromEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestFloatFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		wantValue float64
+		isErr     bool
+	}{
+		{
+			name:      "get value: standerd case",
+			key:       "smallpox",
+			value:     "24.5",
+			wantValue: 24.5,
+			isErr:     false,
+		},
+		{
+			name:      "get value: default case",
+			key:       envSimBaseline,
+			value:     "",
+			wantValue: 25,
+			isErr:     false,
+		},
+		{
+			name:      "must not be blank",
+			key:       "smallpox",
+			value:     "",
+			wantValue: 0,
+			isErr:     true,
+		},
+		{
+			name:      "must be a number",
+			key:       "smallpox",
+			value:     "a",
+			wantValue: 0,
+			isErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			got, err := floatFromEnv(tt.key)
+			if got != tt.wantValue {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestSensorsFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    string
+		sysfsRoot  string
+		buses      string
+		resolution string
+		allow      string
+		deny       string
+		probes     string
+		addrs      string
+		baseline   string
+		wantConfig ds18b20.Config
+		isErr      bool
+	}{
+		{
+			name:       "default backend case",
+			wantConfig: ds18b20.Config{Retry: ds18b20.DefaultRetry},
+			isErr:      false,
+		},
+		{
+			name:    "sim backend case",
+			backend: "sim",
+			probes:  "3",
+			wantConfig: ds18b20.Config{
+				Backend: ds18b20.BackendSim,
+				Sim:     ds18b20.SimConfig{Probes: 3, Baseline: 25},
+				Retry:   ds18b20.DefaultRetry,
+			},
+			isErr: false,
+		},
+		{
+			name:     "sim backend with addresses case",
+			backend:  "sim",
+			addrs:    "293ce10457784c28, 293ce10457784c29",
+			baseline: "18.5",
+			wantConfig: ds18b20.Config{
+				Backend: ds18b20.BackendSim,
+				Retry:   ds18b20.DefaultRetry,
+				Sim: ds18b20.SimConfig{
+					Probes:   1,
+					Addrs:    []onewire.Address{0x293ce10457784c28, 0x293ce10457784c29},
+					Baseline: 18.5,
+				},
+			},
+			isErr: false,
+		},
+		{
+			name:      "sysfs backend case",
+			backend:   "sysfs",
+			sysfsRoot: "/tmp/w1",
+			wantConfig: ds18b20.Config{
+				Backend:   ds18b20.BackendSysfs,
+				SysfsRoot: "/tmp/w1",
+				Retry:     ds18b20.DefaultRetry,
+			},
+			isErr: false,
+		},
+		{
+			name:       "buses and lists case",
+			buses:      "1, 2",
+			resolution: "12",
+			allow:      "293ce10457784c28",
+			deny:       "293ce10457784c29",
+			wantConfig: ds18b20.Config{
+				Buses:      []int{1, 2},
+				Resolution: 12,
+				Allow:      []onewire.Address{0x293ce10457784c28},
+				Deny:       []onewire.Address{0x293ce10457784c29},
+				Retry:      ds18b20.DefaultRetry,
+			},
+			isErr: false,
+		},
+		{
+			name:       "invalid bus case",
+			buses:      "one",
+			wantConfig: ds18b20.Config{},
+			isErr:      true,
+		},
+		{
+			name:       "unknown backend case",
+			backend:    "gpio",
+			wantConfig: ds18b20.Config{},
+			isErr:      true,
+		},
+		{
+			name:       "invalid address case",
+			backend:    "sim",
+			addrs:      "sump",
+			wantConfig: ds18b20.Config{},
+			isErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("acm_sensorBackend", tt.backend)
+			t.Setenv("acm_sysfsRoot", tt.sysfsRoot)
+			t.Setenv("acm_buses", tt.buses)
+			t.Setenv("acm_resolution", tt.resolution)
+			t.Setenv("acm_allow", tt.allow)
+			t.Setenv("acm_deny", tt.deny)
+			t.Setenv("acm_simProbes", tt.probes)
+			t.Setenv("acm_simAddrs", tt.addrs)
+			t.Setenv("acm_simBaseline", tt.baseline)
+			got, err := sensorsFromEnv()
+			if !reflect.DeepEqual(got, tt.wantConfig) {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantConfig)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestCalibrationFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		wantValue map[onewire.Address]ds18b20.Calibration
+		isErr     bool
+	}{
+		{
+			name:      "blank",
+			key:       "smallpox",
+			value:     "",
+			wantValue: nil,
+			isErr:     false,
+		},
+		{
+			name:  "offset and gain",
+			key:   "smallpox",
+			value: "293ce10457784c28:0.3, 293ce10457784c29:-0.5:1.02",
+			wantValue: map[onewire.Address]ds18b20.Calibration{
+				0x293ce10457784c28: {Offset: 0.3},
+				0x293ce10457784c29: {Offset: -0.5, Gain: 1.02},
+			},
+			isErr: false,
+		},
+		{
+			name:      "missing offset",
+			key:       "smallpox",
+			value:     "293ce10457784c28",
+			wantValue: nil,
+			isErr:     true,
+		},
+		{
+			name:      "offset must be a number",
+			key:       "smallpox",
+			value:     "293ce10457784c28:warm",
+			wantValue: nil,
+			isErr:     true,
+		},
+		{
+			name:      "gain must not be zero",
+			key:       "smallpox",
+			value:     "293ce10457784c28:0.5:0",
+			wantValue: nil,
+			isErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			got, err := calibrationFromEnv(tt.key)
+			if !reflect.DeepEqual(got, tt.wantValue) {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestAliasesFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		wantValue map[onewire.Address]sensor.Meta
+		isErr     bool
+	}{
+		{
+			name:      "blank",
+			key:       "smallpox",
+			value:     "",
+			wantValue: nil,
+			isErr:     false,
+		},
+		{
+			name:  "alias, tank and location",
+			key:   "smallpox",
+			value: "293ce10457784c28:sump, 293ce10457784c29:display-tank:display:bottom",
+			wantValue: map[onewire.Address]sensor.Meta{
+				0x293ce10457784c28: {Alias: "sump"},
+				0x293ce10457784c29: {Alias: "display-tank", Tank: "display", Location: "bottom"},
+			},
+			isErr: false,
+		},
+		{
+			name:      "missing alias",
+			key:       "smallpox",
+			value:     "293ce10457784c28",
+			wantValue: nil,
+			isErr:     true,
+		},
+		{
+			name:      "invalid address",
+			key:       "smallpox",
+			value:     "sump:sump",
+			wantValue: nil,
+			isErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			got, err := aliasesFromEnv(tt.key)
+			if !reflect.DeepEqual(got, tt.wantValue) {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeout       string
+		maxAttempts   string
+		retryDelay    string
+		retryMaxDelay string
+		wantValue     ds18b20.RetryPolicy
+		isErr         bool
+	}{
+		{
+			name:      "default case",
+			wantValue: ds18b20.DefaultRetry,
+			isErr:     false,
+		},
+		{
+			name:          "standerd case",
+			timeout:       "5000",
+			maxAttempts:   "5",
+			retryDelay:    "250",
+			retryMaxDelay: "1000",
+			wantValue: ds18b20.RetryPolicy{
+				Timeout:     5 * time.Second,
+				MaxAttempts: 5,
+				Backoff:     backoff.Backoff{Base: 250 * time.Millisecond, Max: time.Second},
+			},
+			isErr: false,
+		},
+		{
+			name:       "retryDelay must not be zero",
+			retryDelay: "0",
+			wantValue:  ds18b20.RetryPolicy{},
+			isErr:      true,
+		},
+		{
+			name:        "maxAttempts must be an integer",
+			maxAttempts: "many",
+			wantValue:   ds18b20.RetryPolicy{},
+			isErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("acm_readTimeout", tt.timeout)
+			t.Setenv("acm_readMaxAttempts", tt.maxAttempts)
+			t.Setenv("acm_readRetryDelay", tt.retryDelay)
+			t.Setenv("acm_readRetryMaxDelay", tt.retryMaxDelay)
+			got, err := retryPolicyFromEnv()
+			if got != tt.wantValue {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			if tt.isErr && err == nil {
+				t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+			}
+		})
+	}
+}
+
+func TestEncoderFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  string
+		wantValue codec.Encoder
+		isErr     bool
+	}{
+		{name: "default case", encoding: "", wantValue: codec.JSON{}, isErr: false},
+		{name: "cbor case", encoding: "cbor", wantValue: codec.CBOR{}, isErr: false},
+		{name: "senml case", encoding: "senml", wantValue: codec.SenML{}, isErr: false},
+		{name: "influx case", encoding: "influx", wantValue: codec.LineProtocol{}, isErr: false},
+		{name: "unknown case", encoding: "xml", wantValue: nil, isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envEncoding, tt.encoding)
+			got, err := encoderFromEnv(envEncoding)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.wantValue {
+				t.Errorf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+// defaultTemplate returns the topic template used when none is configured
+func defaultTemplate(t *testing.T) topic.Template {
+	t.Helper()
+	tmpl, err := topic.Parse(defaultTopicTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestTopicFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue string
+		isErr     bool
+	}{
+		{name: "default case", value: "", wantValue: "/example/status", isErr: false},
+		{name: "set case", value: "acm/status", wantValue: "acm/status", isErr: false},
+		{name: "wildcard case", value: "acm/+/status", wantValue: "", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envStatusTopic, tt.value)
+			got, err := topicFromEnv(envStatusTopic, "/example/status")
+			if (err != nil) != tt.isErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestTopicTemplateFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue string
+		isErr     bool
+	}{
+		{name: "default case", value: "", wantValue: defaultTopicTemplate, isErr: false},
+		{name: "set case", value: "{site}/{tank}/{kind}/{alias}", wantValue: "{site}/{tank}/{kind}/{alias}", isErr: false},
+		{name: "wildcard case", value: "/example/#", wantValue: "", isErr: true},
+		{name: "unknown variable case", value: "{topic}/{room}", wantValue: "", isErr: true},
+		{name: "no sensor variable case", value: "{site}/{kind}", wantValue: "", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envTopicTemplate, tt.value)
+			got, err := topicTemplateFromEnv(envTopicTemplate, defaultTopicTemplate)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.String() != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestDropPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue dropPolicy
+		isErr     bool
+	}{
+		{name: "default case", value: "", wantValue: dropNone, isErr: false},
+		{name: "drop oldest case", value: "drop-oldest", wantValue: dropOldest, isErr: false},
+		{name: "drop newest case", value: "drop-newest", wantValue: dropNewest, isErr: false},
+		{name: "unknown case", value: "drop-all", wantValue: "", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envPublishDropPolicy, tt.value)
+			got, err := dropPolicyFromEnv(envPublishDropPolicy)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		contents  string
+		wantValue map[string]string
+		isErr     bool
+	}{
+		{name: "no file case", wantValue: nil},
+		{
+			name:     "yaml case",
+			file:     "acm.yaml",
+			contents: "serverURL: mqtt://localhost:1883\nqos: 1\nallow: [293ce10457784c28, 28ff641d8f16043b]\n",
+			wantValue: map[string]string{
+				"acm_serverURL": "mqtt://localhost:1883",
+				"acm_qos":       "1",
+				"acm_allow":     "293ce10457784c28,28ff641d8f16043b",
+			},
+		},
+		{
+			name:     "toml case",
+			file:     "acm.toml",
+			contents: "brokers = [\"mqtt://a:1883\", \"mqtt://b:1883\"]\nbatch = true\n\n[[probes]]\naddress = \"293ce10457784c28\"\nalias = \"sump\"\ndeadband = 0.1\n",
+			wantValue: map[string]string{
+				"acm_serverURL":      "mqtt://a:1883,mqtt://b:1883",
+				"acm_batch":          "true",
+				"acm_aliases":        "293ce10457784c28:sump::",
+				"acm_calibration":    "",
+				"acm_probeDeadbands": "293ce10457784c28:0.1",
+			},
+		},
+		{name: "unknown key case", file: "acm.yaml", contents: "servrURL: mqtt://localhost:1883\n", isErr: true},
+		{name: "brokers and serverURL case", file: "acm.yaml", contents: "serverURL: mqtt://a:1883\nbrokers: [mqtt://b:1883]\n", isErr: true},
+		{name: "probes and aliases case", file: "acm.yaml", contents: "aliases: 293ce10457784c28:sump\nprobes: [{address: 293ce10457784c28}]\n", isErr: true},
+		{name: "probe without address case", file: "acm.yaml", contents: "probes: [{alias: sump}]\n", isErr: true},
+		{name: "probe alias with colon case", file: "acm.yaml", contents: "probes: [{address: 293ce10457784c28, alias: \"a:b\"}]\n", isErr: true},
+		{name: "nested value case", file: "acm.yaml", contents: "topic: {a: b}\n", isErr: true},
+		{name: "invalid yaml case", file: "acm.yaml", contents: "topic: [\n", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), tt.file)
+				if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := readConfigFile(path)
+			if tt.isErr {
+				if err == nil {
+					t.Fatalf("unexpected error: got: %v, want: %t", err, tt.isErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantValue) {
+				t.Errorf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestConfigFilePath(t *testing.T) {
+	t.Setenv(envConfigFile, "/etc/acm/env.yaml")
+	if got := configFilePath(""); got != "/etc/acm/env.yaml" {
+		t.Errorf("unexpected value: got: %v, want: %v", got, "/etc/acm/env.yaml")
+	}
+	if got := configFilePath("/etc/acm/flag.toml"); got != "/etc/acm/flag.toml" {
+		t.Errorf("unexpected value: got: %v, want: %v", got, "/etc/acm/flag.toml")
+	}
+}
+
+// writeConfigFile writes contents to a configuration file called name and returns what was read from it; nothing
+// is written if contents is blank
+func writeConfigFile(t *testing.T, name string, contents string) map[string]string {
+	t.Helper()
+	t.Cleanup(func() { fileConfig = nil })
+	if contents == "" {
+		return nil
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return values
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings may also be read from a YAML or TOML file (chosen by the .toml extension), its path being given by
+// the -config flag or, failing that, the acm_configFile environmental variable. Keys are the names of the
+// environmental variables without the acm_ prefix, lists may be used wherever a comma separated list is
+// expected and two nested lists are accepted:
+//
+//	clientID: publisher00001
+//	topic: aquarium/sensors
+//	brokers:            # in place of serverURL, tried in turn
+//	  - mqtts://broker1.example.com:8883
+//	  - mqtts://broker2.example.com:8883
+//	probes:             # in place of aliases, calibration and probeDeadbands
+//	  - address: 293ce10457784c28
+//	    alias: sump
+//	    tank: display
+//	    location: bottom
+//	    offset: -0.25
+//	    gain: 1.01
+//	    deadband: 0.05
+//
+// Addresses made of digits only must be quoted so that they are not read as numbers.
+//
+// Precedence, highest first: environmental variables that are set and not blank, the configuration file, then
+// the defaults.
+
+const envConfigFile = "acm_configFile" // path of the YAML or TOML configuration file
+
+// fileConfig holds the values read from the configuration file, keyed by environmental variable
+var fileConfig map[string]string
+
+// getenv returns the value of the environmental variable key, falling back to the configuration file then to the
+// declared default when blank
+func getenv(key string) string {
+	if s := os.Getenv(key); strings.TrimSpace(s) != "" {
+		return s
+	}
+	if s := fileConfig[key]; strings.TrimSpace(s) != "" {
+		return s
+	}
+	return configDefaults[key]
+}
+
+// knownKey reports whether key is one of the environmental variables making up the configuration
+func knownKey(key string) bool {
+	if _, ok := configDefaults[key]; ok {
+		return true
+	}
+	for _, k := range requiredKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// configFilePath returns the path of the configuration file; flag takes precedence over the environment
+func configFilePath(path string) string {
+	if path != "" {
+		return path
+	}
+	return stringFromEnv(envConfigFile)
+}
+
+// readConfigFile - Reads the configuration file at path; nothing is read if path is blank
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		_, err = toml.Decode(string(b), &raw)
+	default:
+		err = yaml.Unmarshal(b, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing configuration file %s: %w", path, err)
+	}
+	values, err := flattenConfig(raw)
+	if err != nil {
+		return nil, fmt.Errorf("configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenConfig maps the settings of the configuration file onto the environmental variables
+func flattenConfig(raw map[string]interface{}) (map[string]string, error) {
+	// Sorted so that errors are reported consistently
+	names := make([]string, 0, len(raw))
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	values := map[string]string{}
+	for _, name := range names {
+		v := raw[name]
+		switch name {
+		case "brokers":
+			s, err := configList(v)
+			if err != nil {
+				return nil, fmt.Errorf("brokers: %w", err)
+			}
+			values[envServerURL] = s
+		case "probes":
+			if err := flattenProbes(v, values); err != nil {
+				return nil, err
+			}
+		default:
+			key := "acm_" + name
+			if !knownKey(key) {
+				return nil, fmt.Errorf("unknown key %s", name)
+			}
+			s, err := configList(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			values[key] = s
+		}
+	}
+
+	if _, ok := raw["brokers"]; ok {
+		if _, ok := raw["serverURL"]; ok {
+			return nil, fmt.Errorf("brokers and serverURL must not both be set")
+		}
+	}
+	if _, ok := raw["probes"]; ok {
+		for _, name := range []string{"aliases", "calibration", "probeDeadbands"} {
+			if _, ok := raw[name]; ok {
+				return nil, fmt.Errorf("probes and %s must not both be set", name)
+			}
+		}
+	}
+	return values, nil
+}
+
+// flattenProbes turns the probes list into the aliases, calibration and probeDeadbands variables
+func flattenProbes(v interface{}, values map[string]string) error {
+	var probes []map[string]interface{}
+	switch l := v.(type) {
+	case []map[string]interface{}: // TOML array of tables
+		probes = l
+	case []interface{}:
+		for _, p := range l {
+			m, ok := p.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("probes must be a list of tables")
+			}
+			probes = append(probes, m)
+		}
+	default:
+		return fmt.Errorf("probes must be a list of tables")
+	}
+
+	var aliases, cals, deadbands []string
+	for i, p := range probes {
+		f := map[string]string{}
+		for k, v := range p {
+			switch k {
+			case "address", "alias", "tank", "location", "offset", "gain", "deadband":
+			default:
+				return fmt.Errorf("probes[%d]: unknown key %s", i, k)
+			}
+			s, err := configScalar(v)
+			if err != nil {
+				return fmt.Errorf("probes[%d]: %s: %w", i, k, err)
+			}
+			if strings.ContainsAny(s, ":,") {
+				return fmt.Errorf("probes[%d]: %s must not contain : or , (is %s)", i, k, s)
+			}
+			f[k] = s
+		}
+		addr := f["address"]
+		if addr == "" {
+			return fmt.Errorf("probes[%d]: address must not be blank", i)
+		}
+		if f["alias"] != "" || f["tank"] != "" || f["location"] != "" {
+			aliases = append(aliases, strings.Join([]string{addr, f["alias"], f["tank"], f["location"]}, ":"))
+		}
+		if f["offset"] != "" || f["gain"] != "" {
+			c := addr + ":" + f["offset"]
+			if f["offset"] == "" {
+				c += "0"
+			}
+			if f["gain"] != "" {
+				c += ":" + f["gain"]
+			}
+			cals = append(cals, c)
+		}
+		if f["deadband"] != "" {
+			deadbands = append(deadbands, addr+":"+f["deadband"])
+		}
+	}
+	values[envAliases] = strings.Join(aliases, ",")
+	values[envCalibration] = strings.Join(cals, ",")
+	values[envProbeDeadbands] = strings.Join(deadbands, ",")
+	return nil
+}
+
+// configList formats a scalar or a list of scalars the way it would be written in the environment
+func configList(v interface{}) (string, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return configScalar(v)
+	}
+	ss := make([]string, 0, len(l))
+	for _, e := range l {
+		s, err := configScalar(e)
+		if err != nil {
+			return "", err
+		}
+		ss = append(ss, s)
+	}
+	return strings.Join(ss, ","), nil
+}
+
+// configScalar formats a string, number or boolean the way it would be written in the environment
+func configScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("must be a string, number or boolean")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// deadband implements report-on-change: a reading is only published when it moved by at least delta since the
+// last published reading of the same probe, or when nothing was published for maxSilence.
+type deadband struct {
+	delta      float64       // absolute change required; 0 publishes every reading
+	maxSilence time.Duration // heartbeat period; 0 never forces a reading out
+
+	deltas map[string]float64  // per probe delta overriding delta, by sensor ID
+	last   map[string]reported // last published reading by sensor ID
+}
+
+// reported is the last reading published for a probe
+type reported struct {
+	values []float64
+	time   time.Time
+}
+
+func newDeadband(delta float64, maxSilence time.Duration) *deadband {
+	return &deadband{delta: delta, maxSilence: maxSilence, deltas: map[string]float64{}, last: map[string]reported{}}
+}
+
+// threshold sets the change required before the reading of the sensor with the given id is published again
+func (d *deadband) threshold(id string, delta float64) {
+	d.deltas[id] = delta
+}
+
+// pass reports whether r, taken from the sensor with the given id, should be published, and if so remembers it
+func (d *deadband) pass(id string, r sensor.Reading) bool {
+	ms := r.Measurements()
+	now := r.Time()
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	delta, ok := d.deltas[id]
+	if !ok {
+		delta = d.delta
+	}
+
+	prev, ok := d.last[id]
+	if ok && delta > 0 && len(prev.values) == len(ms) && (d.maxSilence == 0 || now.Sub(prev.time) < d.maxSilence) {
+		changed := false
+		for i, m := range ms {
+			if math.Abs(m.Value-prev.values[i]) >= delta {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return false
+		}
+	}
+
+	values := make([]float64, len(ms))
+	for i, m := range ms {
+		values[i] = m.Value
+	}
+	d.last[id] = reported{values: values, time: now}
+	return true
+}
+
+// forget drops what was published for the sensor so that its next reading is published whatever its value
+func (d *deadband) forget(id string) {
+	delete(d.last, id)
+}
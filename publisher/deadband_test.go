@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+)
+
+func TestDeadband(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		delta      float64
+		maxSilence time.Duration
+		values     []float64
+		wantValue  []bool
+	}{
+		{name: "disabled case", values: []float64{25, 25, 25}, wantValue: []bool{true, true, true}},
+		{name: "deadband case", delta: 0.1, values: []float64{25, 25.05, 25.1, 25.15, 24.9}, wantValue: []bool{true, false, true, false, true}},
+		{name: "slow drift case", delta: 0.1, values: []float64{25, 25.06, 25.12}, wantValue: []bool{true, false, true}},
+		{name: "heartbeat case", delta: 1, maxSilence: 2 * time.Minute, values: []float64{25, 25, 25, 25, 25}, wantValue: []bool{true, false, true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeadband(tt.delta, tt.maxSilence)
+			for i, v := range tt.values {
+				// One reading a minute
+				r := ds18b20.Env{Temperature: v, Timestamp: start.Add(time.Duration(i) * time.Minute)}
+				if got := d.pass("293ce10457784c28", r); got != tt.wantValue[i] {
+					t.Errorf("at index %d: unexpected value: got: %v, want: %v", i, got, tt.wantValue[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeadbandForget(t *testing.T) {
+	d := newDeadband(1, 0)
+	r := ds18b20.Env{Temperature: 25, Timestamp: time.Now()}
+	if !d.pass("a", r) || d.pass("a", r) {
+		t.Fatal("unexpected value: the first reading only should pass")
+	}
+	if !d.pass("b", r) {
+		t.Error("unexpected value: probes must be tracked separately")
+	}
+	d.forget("a")
+	if !d.pass("a", r) {
+		t.Error("unexpected value: a forgotten probe must be published again")
+	}
+}
+
+func TestDeadbandThreshold(t *testing.T) {
+	d := newDeadband(1, 0)
+	d.threshold("a", 0.1)
+	for i, v := range []float64{25, 25.5} {
+		r := ds18b20.Env{Temperature: v, Timestamp: time.Now()}
+		if got := d.pass("a", r); !got {
+			t.Errorf("at index %d: unexpected value: got: %v, want: %v", i, got, true)
+		}
+		if got := d.pass("b", r); got != (i == 0) {
+			t.Errorf("at index %d: unexpected value: got: %v, want: %v", i, got, i == 0)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// haComponent is the Home Assistant entity type the probes are announced as
+const haComponent = "sensor"
+
+// invalidNodeID matches the characters Home Assistant does not accept in a node id
+var invalidNodeID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// haNodeID turns s (usually the client id) into a valid Home Assistant node id
+func haNodeID(s string) string {
+	return invalidNodeID.ReplaceAllString(s, "_")
+}
+
+// haDevice groups the probes of this publisher into a single Home Assistant device
+type haDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+}
+
+// haAvailability is one of the topics Home Assistant watches to tell whether a probe is available
+type haAvailability struct {
+	Topic               string `json:"topic"`
+	PayloadAvailable    string `json:"payload_available,omitempty"`
+	PayloadNotAvailable string `json:"payload_not_available,omitempty"`
+	ValueTemplate       string `json:"value_template,omitempty"`
+}
+
+// haConfig is the payload of a Home Assistant MQTT discovery message
+type haConfig struct {
+	Name              string           `json:"name"`
+	UniqueID          string           `json:"unique_id"`
+	ObjectID          string           `json:"object_id"`
+	DeviceClass       string           `json:"device_class"`
+	StateClass        string           `json:"state_class"`
+	UnitOfMeasurement string           `json:"unit_of_measurement"`
+	StateTopic        string           `json:"state_topic"`
+	ValueTemplate     string           `json:"value_template"`
+	Availability      []haAvailability `json:"availability"`
+	AvailabilityMode  string           `json:"availability_mode"`
+	Device            haDevice         `json:"device"`
+}
+
+// discovery builds the Home Assistant discovery messages for the probes
+type discovery struct {
+	prefix        string // discovery topic prefix, usually "homeassistant"
+	node          string // node id, shared by every probe of this publisher
+	base          string // base topic of the publisher
+	topics        topics // topics the readings are published on
+	status        string // status topic of the publisher
+	valueTemplate string // extracts the temperature from a reading payload
+}
+
+// haValueTemplates lists the encoders Home Assistant can read the temperature from
+var haValueTemplates = map[string]string{
+	codec.JSON{}.ContentType():  "{{ value_json.temperature }}",
+	codec.SenML{}.ContentType(): "{{ value_json[0].v }}",
+}
+
+func newDiscovery(cfg config, tp topics) discovery {
+	return discovery{
+		topics:        tp,
+		prefix:        cfg.haDiscoveryPrefix,
+		node:          cfg.haNodeID,
+		base:          cfg.topic,
+		status:        cfg.statusTopic,
+		valueTemplate: haValueTemplates[cfg.encoder.ContentType()],
+	}
+}
+
+// topic returns the retained topic the discovery message for s is published on
+func (d discovery) topic(s sensor.Sensor) string {
+	return strings.Join([]string{d.prefix, haComponent, d.node, s.ID(), "config"}, "/")
+}
+
+// config returns the discovery payload announcing s
+func (d discovery) config(s sensor.Sensor) ([]byte, error) {
+	return json.Marshal(haConfig{
+		Name:              sensor.Name(s),
+		UniqueID:          "acm_" + s.ID(),
+		ObjectID:          d.node + "_" + s.ID(),
+		DeviceClass:       string(sensor.Temperature),
+		StateClass:        "measurement",
+		UnitOfMeasurement: "°C",
+		StateTopic:        d.topics.reading(s),
+		ValueTemplate:     d.valueTemplate,
+		// The probes are available as long as the publisher is online and the bus reports them
+		Availability: []haAvailability{
+			{Topic: d.status, PayloadAvailable: statusOnline, PayloadNotAvailable: statusOffline},
+			{Topic: sensorStatusTopic(d.base), ValueTemplate: "{{ '" + statusOnline + "' if value_json.status == '" + sensorsOK + "' else '" + statusOffline + "' }}"},
+		},
+		AvailabilityMode: "all",
+		Device:           haDevice{Identifiers: []string{d.node}, Name: d.node},
+	})
+}
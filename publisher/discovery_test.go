@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lupinthe14th/acm/publisher/codec"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/topic"
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestHANodeID(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantValue string
+	}{
+		{name: "valid case", value: "publisher-00_1", wantValue: "publisher-00_1"},
+		{name: "invalid characters case", value: "pi.local/acm 1", wantValue: "pi_local_acm_1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := haNodeID(tt.value); got != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ds, err := ds18b20.Open(ds18b20.Config{
+		Backend: ds18b20.BackendSim,
+		Sim:     ds18b20.SimConfig{Addrs: []onewire.Address{0x293ce10457784c28}},
+		Meta:    map[onewire.Address]sensor.Meta{0x293ce10457784c28: {Alias: "sump"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ds.Sensors()[0]
+
+	tmpl, err := topic.Parse("{topic}/{kind}/{alias}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{topic: "sensors/pi", topicTemplate: tmpl, statusTopic: "sensors/pi/status", encoder: codec.SenML{}, haDiscoveryPrefix: "homeassistant", haNodeID: "pi"}
+	d := newDiscovery(cfg, newTopics(cfg, "pi"))
+	if got, want := d.topic(s), "homeassistant/sensor/pi/293ce10457784c28/config"; got != want {
+		t.Errorf("unexpected value: got: %s, want: %s", got, want)
+	}
+
+	msg, err := d.config(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got haConfig
+	if err := json.Unmarshal(msg, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := haConfig{
+		Name:              "sump",
+		UniqueID:          "acm_293ce10457784c28",
+		ObjectID:          "pi_293ce10457784c28",
+		DeviceClass:       "temperature",
+		StateClass:        "measurement",
+		UnitOfMeasurement: "°C",
+		StateTopic:        "sensors/pi/temperature/sump",
+		ValueTemplate:     "{{ value_json[0].v }}",
+		Availability: []haAvailability{
+			{Topic: "sensors/pi/status", PayloadAvailable: "online", PayloadNotAvailable: "offline"},
+			{Topic: "sensors/pi/sensors", ValueTemplate: "{{ 'online' if value_json.status == 'ok' else 'offline' }}"},
+		},
+		AvailabilityMode: "all",
+		Device:           haDevice{Identifiers: []string{"pi"}, Name: "pi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected value: got: %+v, want: %+v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package ds18b20
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"periph.io/x/conn/v3/onewire"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/devices/v3/ds18b20"
+	host "periph.io/x/host/v3"
+	"periph.io/x/host/v3/netlink"
+)
+
+// bus is the backend used to talk to the probes attached to a 1-wire bus.
+// Every backend exposes the same Devs/Dev surface on top of it.
+type bus interface {
+	// search returns the addresses of the probes present on the bus.
+	search() ([]onewire.Address, error)
+	// open prepares a probe found by search for reading.
+	open(addr onewire.Address) error
+	// convertAll starts a conversion on every probe and waits for it to complete.
+	convertAll() error
+	// lastTemp reads the result of the last conversion of a probe.
+	lastTemp(addr onewire.Address) (physic.Temperature, error)
+}
+
+// newBuses returns one backend per bus selected by cfg.
+func newBuses(cfg Config) ([]bus, error) {
+	switch cfg.Backend {
+	case "", BackendNetlink:
+		ids := cfg.Buses
+		if len(ids) == 0 {
+			ids = []int{DefaultBus}
+		}
+		var bs []bus
+		for _, id := range ids {
+			b, err := newNetlinkBus(id, cfg.resolution())
+			if err != nil {
+				for _, b := range bs {
+					_ = b.(*netlinkBus).Close()
+				}
+				return nil, err
+			}
+			bs = append(bs, b)
+		}
+		return bs, nil
+	case BackendSim:
+		return []bus{newSimBus(cfg.Sim, cfg.resolution())}, nil
+	case BackendSysfs:
+		if len(cfg.Buses) == 0 {
+			return []bus{newSysfsBus(cfg.SysfsRoot, 0, cfg.resolution())}, nil
+		}
+		var bs []bus
+		for _, id := range cfg.Buses {
+			bs = append(bs, newSysfsBus(cfg.SysfsRoot, id, cfg.resolution()))
+		}
+		return bs, nil
+	default:
+		return nil, fmt.Errorf("unknown ds18b20 backend %q", cfg.Backend)
+	}
+}
+
+// netlinkBus talks to the probes through the w1 netlink connector.
+type netlinkBus struct {
+	bus        *netlink.OneWire
+	resolution int
+	devs       map[onewire.Address]*ds18b20.Dev
+}
+
+func newNetlinkBus(id, resolution int) (*netlinkBus, error) {
+	// Make sure periph is initialized.
+	if _, err := host.Init(); err != nil {
+		return nil, err
+	}
+
+	// get 1-wire bus
+	oneBus, err := netlink.New(uint32(id))
+	if err != nil {
+		return nil, fmt.Errorf("1wire bus %d: %w", id, err)
+	}
+	log.Debug().Msgf("1wire bus (%#+v)", oneBus)
+
+	return &netlinkBus{bus: oneBus, resolution: resolution, devs: map[onewire.Address]*ds18b20.Dev{}}, nil
+}
+
+// Close implements io.Closer.
+func (b *netlinkBus) Close() error {
+	return b.bus.Close()
+}
+
+func (b *netlinkBus) search() ([]onewire.Address, error) {
+	return b.bus.Search(false)
+}
+
+func (b *netlinkBus) open(addr onewire.Address) error {
+	if _, ok := b.devs[addr]; ok {
+		return nil
+	}
+	// Open a handle to a ds18b20 connected on the 1-wire bus
+	dev, err := ds18b20.New(b.bus, addr, b.resolution)
+	if err != nil {
+		return fmt.Errorf("ds18b20 init: %w", err)
+	}
+	log.Debug().Msgf("ds18b20 (%#+v)", dev)
+	b.devs[addr] = dev
+	return nil
+}
+
+func (b *netlinkBus) convertAll() error {
+	return ds18b20.ConvertAll(b.bus, b.resolution)
+}
+
+func (b *netlinkBus) lastTemp(addr onewire.Address) (physic.Temperature, error) {
+	dev, ok := b.devs[addr]
+	if !ok {
+		return 0, fmt.Errorf("ds18b20: unknown device %x", addr)
+	}
+	t, err := dev.LastTemp()
+	if err != nil || t != physic.ZeroCelsius {
+		return t, err
+	}
+	// 0°C is also what a blank scratchpad decodes to; read it again to tell them apart
+	spad := make([]byte, 9)
+	d := onewire.Dev{Bus: b.bus, Addr: addr}
+	if err := d.Tx([]byte{0xbe}, spad); err != nil { // Read Scratchpad
+		return 0, err
+	}
+	if blankScratchpad(spad) {
+		return 0, errNoResponse
+	}
+	return t, nil
+}
@@ -0,0 +1,26 @@
+package ds18b20
+
+import "math"
+
+// Calibration corrects the readings of a probe checked against a reference
+// thermometer. The corrected temperature is Gain*raw + Offset; a zero Gain is
+// treated as 1 so that an offset on its own can be given.
+type Calibration struct {
+	Offset float64 // °C
+	Gain   float64
+}
+
+// Apply returns the corrected temperature.
+func (c Calibration) Apply(raw float64) float64 {
+	gain := c.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	// Round to µ°C to avoid publishing floating point noise such as 24.799999999.
+	return math.Round((gain*raw+c.Offset)*1e6) / 1e6
+}
+
+// isZero reports whether the calibration leaves readings unchanged.
+func (c Calibration) isZero() bool {
+	return c.Offset == 0 && (c.Gain == 0 || c.Gain == 1)
+}
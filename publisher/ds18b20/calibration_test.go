@@ -0,0 +1,78 @@
+package ds18b20
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestCalibrationApply(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  Calibration
+		raw  float64
+		want float64
+	}{
+		{name: "zero", cal: Calibration{}, raw: 24.5, want: 24.5},
+		{name: "offset", cal: Calibration{Offset: 0.3}, raw: 24.5, want: 24.8},
+		{name: "negative offset", cal: Calibration{Offset: -1}, raw: 24.5, want: 23.5},
+		{name: "gain", cal: Calibration{Gain: 1.02, Offset: -0.5}, raw: 25, want: 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cal.Apply(tt.raw); got != tt.want {
+				t.Errorf("Apply(%v) = %v; want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAllCalibrated(t *testing.T) {
+	b := &countingBus{temps: map[onewire.Address]float64{0x293ce10457784c28: 24.5, 0x293ce10457784c29: 25}}
+	ds := &Devs{
+		devs: []Dev{
+			{bus: b, addr: 0x293ce10457784c28, cal: Calibration{Offset: 0.25}},
+			{bus: b, addr: 0x293ce10457784c29},
+		},
+	}
+
+	rs := ds.ReadAll(context.Background())
+	if rs[0].Env.Temperature != 24.75 || rs[0].Env.Raw == nil || *rs[0].Env.Raw != 24.5 {
+		t.Errorf("calibrated Env = %+v; want 24.75 from raw 24.5", rs[0].Env)
+	}
+
+	// The raw value is only part of the payload of calibrated probes.
+	var m map[string]interface{}
+	msg, _ := json.Marshal(rs[1].Env)
+	if err := json.Unmarshal(msg, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["raw"]; ok {
+		t.Errorf("uncalibrated payload %s contains raw", msg)
+	}
+}
+
+func TestReadAllCalibratedZero(t *testing.T) {
+	// Ice water: a raw reading of 0°C must still be part of the payload.
+	b := &countingBus{temps: map[onewire.Address]float64{0x293ce10457784c28: 0}}
+	ds := &Devs{devs: []Dev{{bus: b, addr: 0x293ce10457784c28, cal: Calibration{Offset: 0.125}}}}
+
+	rs := ds.ReadAll(context.Background())
+	if rs[0].Err != nil {
+		t.Fatal(rs[0].Err)
+	}
+	var m map[string]interface{}
+	msg, _ := json.Marshal(rs[0].Env)
+	if err := json.Unmarshal(msg, &m); err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := m["raw"]; !ok || raw != 0.0 {
+		t.Errorf("calibrated payload %s; want raw 0", msg)
+	}
+	if m["temperature"] != 0.125 {
+		t.Errorf("calibrated payload %s; want temperature 0.125", msg)
+	}
+}
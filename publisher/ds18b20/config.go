@@ -0,0 +1,102 @@
+package ds18b20
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"periph.io/x/conn/v3/onewire"
+)
+
+// Backend selects how the probes are accessed.
+type Backend string
+
+const (
+	BackendNetlink Backend = "netlink" // w1 netlink connector (default)
+	BackendSim     Backend = "sim"     // simulated probes, no hardware required
+	BackendSysfs   Backend = "sysfs"   // w1_therm kernel driver files
+)
+
+const (
+	DefaultBus        = 1  // 1-wire bus master used when none is configured
+	DefaultResolution = 10 // bits; 0.25°C in 188ms is a good compromise
+
+	DefaultOfflineRetention = 24 * time.Hour // how long Rescan keeps a probe that is no longer found
+)
+
+// Config holds the settings used by Open.
+type Config struct {
+	Backend Backend   // backend to use; blank selects BackendNetlink
+	Sim     SimConfig // settings for BackendSim
+
+	SysfsRoot string // w1 devices directory for BackendSysfs; blank selects DefaultSysfsRoot
+
+	Buses      []int             // bus master numbers; blank selects DefaultBus (netlink) or every bus (sysfs)
+	Resolution int               // 9-12 bits; 0 selects DefaultResolution
+	Allow      []onewire.Address // if not empty, only these probes are used
+	Deny       []onewire.Address // probes that are never used
+	Retry      RetryPolicy       // timeout and retries of a read
+
+	OfflineRetention time.Duration // probes missing for longer are dropped by Rescan; 0 selects DefaultOfflineRetention
+
+	Calibration map[onewire.Address]Calibration // per probe correction
+	Meta        map[onewire.Address]sensor.Meta // per probe alias, tank and location
+}
+
+// Validate checks the settings that do not depend on the hardware; Open and
+// Scan call it too.
+func (c Config) Validate() error {
+	if c.Resolution != 0 && (c.Resolution < 9 || c.Resolution > 12) {
+		return fmt.Errorf("ds18b20: resolution must be between 9 and 12 bits (is %d)", c.Resolution)
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	for a, m := range c.Meta {
+		if strings.ContainsAny(m.Alias, "/+#") {
+			return fmt.Errorf("ds18b20: alias %q of %x must not contain '/', '+' or '#'", m.Alias, a)
+		}
+	}
+	if c.OfflineRetention < 0 {
+		return fmt.Errorf("ds18b20: offline retention must not be negative (is %s)", c.OfflineRetention)
+	}
+	for _, b := range c.Buses {
+		if b < 0 {
+			return fmt.Errorf("ds18b20: invalid bus number %d", b)
+		}
+	}
+	return nil
+}
+
+func (c Config) resolution() int {
+	if c.Resolution == 0 {
+		return DefaultResolution
+	}
+	return c.Resolution
+}
+
+func (c Config) offlineRetention() time.Duration {
+	if c.OfflineRetention == 0 {
+		return DefaultOfflineRetention
+	}
+	return c.OfflineRetention
+}
+
+// permits reports whether the probe passes the allow and deny lists.
+func (c Config) permits(addr onewire.Address) bool {
+	for _, a := range c.Deny {
+		if a == addr {
+			return false
+		}
+	}
+	if len(c.Allow) == 0 {
+		return true
+	}
+	for _, a := range c.Allow {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package ds18b20
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestConfigPermits(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		addr onewire.Address
+		want bool
+	}{
+		{name: "no lists", cfg: Config{}, addr: 0x293ce10457784c28, want: true},
+		{name: "allowed", cfg: Config{Allow: []onewire.Address{0x293ce10457784c28}}, addr: 0x293ce10457784c28, want: true},
+		{name: "not allowed", cfg: Config{Allow: []onewire.Address{0x293ce10457784c28}}, addr: 0x293ce10457784c29, want: false},
+		{name: "denied", cfg: Config{Deny: []onewire.Address{0x293ce10457784c28}}, addr: 0x293ce10457784c28, want: false},
+		{
+			name: "deny wins over allow",
+			cfg:  Config{Allow: []onewire.Address{0x293ce10457784c28}, Deny: []onewire.Address{0x293ce10457784c28}},
+			addr: 0x293ce10457784c28,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.permits(tt.addr); got != tt.want {
+				t.Errorf("permits(%x) = %t; want %t", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution int
+		isErr      bool
+	}{
+		{name: "default", resolution: 0},
+		{name: "9 bits", resolution: 9},
+		{name: "12 bits", resolution: 12},
+		{name: "too low", resolution: 8, isErr: true},
+		{name: "too high", resolution: 13, isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(Config{Backend: BackendSim, Resolution: tt.resolution})
+			if tt.isErr && err == nil {
+				t.Fatalf("expected error for resolution %d", tt.resolution)
+			}
+			if !tt.isErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOpenAllowDeny(t *testing.T) {
+	ds, err := Open(Config{
+		Backend: BackendSim,
+		Sim:     SimConfig{Probes: 3},
+		Allow:   []onewire.Address{simAddress(1), simAddress(2)},
+		Deny:    []onewire.Address{simAddress(2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs := ds.GetDevs()
+	if len(devs) != 1 || devs[0].addr != simAddress(1) {
+		t.Errorf("GetDevs() = %v; want only %x", devs, simAddress(1))
+	}
+}
+
+func TestOpenMeta(t *testing.T) {
+	ds, err := Open(Config{
+		Backend: BackendSim,
+		Sim:     SimConfig{Probes: 2, Baseline: 25},
+		Meta:    map[onewire.Address]sensor.Meta{simAddress(2): {Alias: "sump", Tank: "display"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := ds.Sensors()
+	if got := sensor.Name(ss[0]); got != ss[0].ID() {
+		t.Errorf("Name() = %s; want the address %s", got, ss[0].ID())
+	}
+	if got := sensor.Name(ss[1]); got != "sump" {
+		t.Errorf("Name() = %s; want sump", got)
+	}
+
+	r := ds.ReadAll(context.Background())[1]
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	msg, err := json.Marshal(r.Env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["id"] != ss[1].ID() || m["alias"] != "sump" || m["tank"] != "display" {
+		t.Errorf("payload %s; want id, alias and tank", msg)
+	}
+	if _, ok := m["location"]; ok {
+		t.Errorf("payload %s contains an empty location", msg)
+	}
+}
+
+func TestOpenInvalidAlias(t *testing.T) {
+	_, err := Open(Config{
+		Backend: BackendSim,
+		Meta:    map[onewire.Address]sensor.Meta{simAddress(1): {Alias: "tank/sump"}},
+	})
+	if err == nil {
+		t.Errorf("expected error for an alias containing '/'")
+	}
+}
@@ -1,89 +1,236 @@
 package ds18b20
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/lupinthe14th/acm/publisher/sensor"
 	"github.com/rs/zerolog/log"
 	"periph.io/x/conn/v3/onewire"
-	"periph.io/x/devices/v3/ds18b20"
-	host "periph.io/x/host/v3"
-	"periph.io/x/host/v3/netlink"
+	"periph.io/x/conn/v3/physic"
 )
 
 type Env struct {
+	ID string `json:"id"` // 1-wire address
+	sensor.Meta
 	Temperature float64   `json:"temperature"`
+	Raw         *float64  `json:"raw,omitempty"` // uncalibrated temperature, only set for calibrated probes
 	Timestamp   time.Time `json:"timestamp"`
+
+	Window *sensor.Stats `json:"stats,omitempty"` // statistics of the window, only set for aggregated readings
 }
 
 type Dev struct {
-	dev  *ds18b20.Dev
-	bus  *netlink.OneWire
-	addr onewire.Address
+	bus   bus
+	addr  onewire.Address
+	cal   Calibration
+	meta  sensor.Meta
+	retry RetryPolicy
 }
 
 type Devs struct {
-	devs []Dev
+	mu      sync.RWMutex // protects devs and offline, which change on Rescan
+	devs    []Dev
+	offline map[onewire.Address]time.Time // devices no longer found on their bus, with the time they went missing
+	retry   RetryPolicy
+	now     func() time.Time
+
+	cfg   Config
+	buses []bus
 }
 
+// New opens the probes on the default 1-wire bus through the netlink backend.
 func New() (*Devs, error) {
-	ds := &Devs{}
+	return Open(Config{Backend: BackendNetlink, Retry: DefaultRetry})
+}
 
-	// Make sure periph is initialized.
-	if _, err := host.Init(); err != nil {
-		return ds, err
-	}
+// Open opens the probes using the backend selected by cfg.
+func Open(cfg Config) (*Devs, error) {
+	ds := &Devs{retry: cfg.Retry, cfg: cfg, now: time.Now}
 
-	// get 1-wire bus
-	oneBus, err := netlink.New(001)
-	if err != nil {
+	if err := cfg.Validate(); err != nil {
 		return ds, err
 	}
-	log.Debug().Msgf("1wire bus (%#+v)", oneBus)
 
-	// get 1wire address
-	addrs, err := oneBus.Search(false)
+	bs, err := newBuses(cfg)
 	if err != nil {
 		return ds, err
 	}
-	log.Debug().Msgf("1wire address (%#+v)", addrs)
+	ds.buses = bs
 
-	for _, addr := range addrs {
-		// Open a handle to a ds18b20 connected on the 1-wire bus using default settings
-		dev, err := ds18b20.New(oneBus, addr, 10)
+	for _, b := range bs {
+		// get 1wire address
+		addrs, err := b.search()
 		if err != nil {
-			return ds, fmt.Errorf("ds18b20 init: %w", err)
+			return ds, err
+		}
+		log.Debug().Msgf("1wire address (%#+v)", addrs)
+
+		for _, addr := range addrs {
+			if !cfg.permits(addr) {
+				log.Info().Msgf("ignoring 1wire device %x", addr)
+				continue
+			}
+			if err := b.open(addr); err != nil {
+				return ds, err
+			}
+			ds.devs = append(ds.devs, ds.newDev(b, addr))
 		}
-		log.Debug().Msgf("ds18b20 (%#+v)", dev)
-		ds.devs = append(ds.devs, Dev{dev: dev, bus: oneBus, addr: addr})
 	}
 	return ds, nil
 }
 
-func (d *Dev) Read() (Env, error) {
-	e := Env{}
-	const timeout = 1 * time.Minute
-	deadline := time.Now().Add(timeout)
-	for tries := 0; time.Now().Before(deadline); tries++ {
-		if err := ds18b20.ConvertAll(d.bus, 10); err != nil {
-			return e, fmt.Errorf("device %v failed to convert: %w", d, err)
+// newDev returns the handle of a probe found on b, with its configured calibration and metadata.
+func (ds *Devs) newDev(b bus, addr onewire.Address) Dev {
+	return Dev{bus: b, addr: addr, cal: ds.cfg.Calibration[addr], meta: ds.cfg.Meta[addr], retry: ds.cfg.Retry}
+}
+
+// Read converts the temperature of the device. Failures are retried according
+// to the retry policy; ctx cancellation stops waiting between attempts at once,
+// although a conversion in progress (at most 752ms) is allowed to complete.
+func (d *Dev) Read(ctx context.Context) (Env, error) {
+	ctx, cancel := d.retry.withTimeout(ctx)
+	defer cancel()
+
+	var err error
+	for attempt := 0; attempt < d.retry.attempts(); attempt++ {
+		if attempt > 0 {
+			log.Info().Msgf("device not responding (%s); retrying...", err)
+			if serr := d.retry.Backoff.Sleep(ctx, attempt-1); serr != nil {
+				return Env{}, fmt.Errorf("device %v: %w (last error: %s)", d, serr, err)
+			}
+		}
+		if err = d.bus.convertAll(); err != nil {
+			err = fmt.Errorf("device %v failed to convert: %w", d, err)
+			continue
 		}
-		temp, err := d.dev.LastTemp()
-		if err == nil {
-			e.Temperature = temp.Celsius()
-			e.Timestamp = time.Now()
-			return e, nil
+		var temp physic.Temperature
+		temp, err = d.bus.lastTemp(d.addr)
+		if err = validate(d.addr, temp, err); err == nil {
+			return d.env(temp.Celsius()), nil
 		}
-		log.Info().Msgf("device not responding (%s); retrying...", err)
-		time.Sleep(time.Second << uint(tries))
+		err = fmt.Errorf("device %v failed to respond: %w", d, err)
 	}
-	return e, fmt.Errorf("device %v failed to respond after %s", d, timeout)
+	return Env{}, err
+}
+
+// Result is the outcome of reading a single device with Devs.ReadAll.
+type Result struct {
+	Dev *Dev
+	Env Env
+	Err error
+}
+
+// ReadAll issues a single conversion per bus and then collects the temperature
+// of every device, which is much faster than calling Read on each of them.
+// Devices that failed are converted again according to the retry policy before
+// their error (a *ReadingError for an invalid reading) is reported; once ctx is
+// done the remaining devices report its error.
+// Devices marked offline by Rescan are not read; their error wraps sensor.ErrOffline.
+func (ds *Devs) ReadAll(ctx context.Context) []Result {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	ctx, cancel := ds.retry.withTimeout(ctx)
+	defer cancel()
+
+	rs := make([]Result, len(ds.devs))
+	var pending []int
+	for i := range ds.devs {
+		rs[i].Dev = &ds.devs[i]
+		if _, ok := ds.offline[ds.devs[i].addr]; ok {
+			rs[i].Err = fmt.Errorf("device %v: %w", rs[i].Dev, sensor.ErrOffline)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for attempt := 0; attempt < ds.retry.attempts() && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			log.Debug().Msgf("%d devices failed; retrying...", len(pending))
+			if err := ds.retry.Backoff.Sleep(ctx, attempt-1); err != nil {
+				break
+			}
+		}
+		var retry []int
+		converted := map[bus]error{}
+		for _, i := range pending {
+			d := rs[i].Dev
+			if err := ctx.Err(); err != nil {
+				rs[i].Err = fmt.Errorf("device %v: %w", d, err)
+				continue
+			}
+			err, ok := converted[d.bus]
+			if !ok {
+				err = d.bus.convertAll()
+				converted[d.bus] = err
+			}
+			if err != nil {
+				rs[i].Err = fmt.Errorf("device %v failed to convert: %w", d, err)
+				retry = append(retry, i)
+				continue
+			}
+			temp, err := d.bus.lastTemp(d.addr)
+			if err = validate(d.addr, temp, err); err != nil {
+				rs[i].Err = fmt.Errorf("device %v failed to respond: %w", d, err)
+				retry = append(retry, i)
+				continue
+			}
+			rs[i].Env = d.env(temp.Celsius())
+			rs[i].Err = nil
+		}
+		pending = retry
+	}
+	return rs
+}
+
+// env builds the reading of a validated raw temperature, applying the probe
+// calibration if any.
+func (d *Dev) env(raw float64) Env {
+	e := Env{ID: d.String(), Meta: d.meta, Temperature: raw, Timestamp: time.Now()}
+	if !d.cal.isZero() {
+		e.Temperature = d.cal.Apply(raw)
+		e.Raw = &raw
+	}
+	return e
 }
 
 func (d *Dev) String() string {
 	return fmt.Sprintf("%x", d.addr)
 }
 
+// Close releases the buses; the devices must not be used afterwards.
+func (ds *Devs) Close() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	var firstErr error
+	for _, b := range ds.buses {
+		if c, ok := b.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	ds.buses = nil
+	ds.devs = nil
+	return firstErr
+}
+
 func (ds *Devs) GetDevs() []Dev {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
 	return ds.devs
 }
+
+// ParseAddress parses a 1-wire address in the hexadecimal form produced by Dev.String.
+func ParseAddress(s string) (onewire.Address, error) {
+	a, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid 1-wire address %q: %w", s, err)
+	}
+	return onewire.Address(a), nil
+}
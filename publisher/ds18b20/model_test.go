@@ -1,18 +1,19 @@
 package ds18b20
 
 import (
+	"context"
+	"errors"
 	"testing"
 
+	"github.com/lupinthe14th/acm/publisher/sensor"
 	"periph.io/x/conn/v3/onewire"
-	"periph.io/x/devices/v3/ds18b20"
-	"periph.io/x/host/v3/netlink"
+	"periph.io/x/conn/v3/physic"
 )
 
 func TestDevString(t *testing.T) {
 	d := Dev{
-		&ds18b20.Dev{},
-		&netlink.OneWire{},
-		onewire.Address(0x293ce10457784c28),
+		bus:  &netlinkBus{},
+		addr: onewire.Address(0x293ce10457784c28),
 	}
 	if s := d.String(); s != "293ce10457784c28" {
 		t.Errorf("Dev.String() = %s; want 293ce10457784c28", s)
@@ -22,12 +23,10 @@ func TestDevString(t *testing.T) {
 func TestGetDevs(t *testing.T) {
 	devsData := []Dev{
 		{
-			dev:  nil,
 			bus:  nil,
 			addr: 0x293ce10457784c28,
 		},
 		{
-			dev:  nil,
 			bus:  nil,
 			addr: 0x293ce10457784c29,
 		},
@@ -49,3 +48,74 @@ func TestGetDevs(t *testing.T) {
 		}
 	}
 }
+
+func TestSensors(t *testing.T) {
+	ds := &Devs{
+		devs: []Dev{
+			{addr: 0x293ce10457784c28},
+			{addr: 0x293ce10457784c29},
+		},
+	}
+
+	ss := ds.Sensors()
+	if len(ss) != 2 {
+		t.Fatalf("expected 2 sensors, got %d", len(ss))
+	}
+	if id := ss[1].ID(); id != "293ce10457784c29" {
+		t.Errorf("Sensors()[1].ID() = %s; want 293ce10457784c29", id)
+	}
+	if k := ss[0].Kind(); k != sensor.Temperature {
+		t.Errorf("Sensors()[0].Kind() = %s; want %s", k, sensor.Temperature)
+	}
+}
+
+// countingBus is a bus that records the number of conversions requested.
+type countingBus struct {
+	conversions int
+	temps       map[onewire.Address]float64
+}
+
+func (b *countingBus) search() ([]onewire.Address, error) { return nil, nil }
+func (b *countingBus) open(onewire.Address) error         { return nil }
+func (b *countingBus) convertAll() error {
+	b.conversions++
+	return nil
+}
+func (b *countingBus) lastTemp(addr onewire.Address) (physic.Temperature, error) {
+	c, ok := b.temps[addr]
+	if !ok {
+		return 0, errors.New("device did not respond")
+	}
+	return physic.Temperature(c*float64(physic.Celsius)) + physic.ZeroCelsius, nil
+}
+
+func TestReadAll(t *testing.T) {
+	b1 := &countingBus{temps: map[onewire.Address]float64{0x293ce10457784c28: 24.5, 0x293ce10457784c29: 25}}
+	b2 := &countingBus{temps: map[onewire.Address]float64{}}
+	ds := &Devs{
+		devs: []Dev{
+			{bus: b1, addr: 0x293ce10457784c28},
+			{bus: b1, addr: 0x293ce10457784c29},
+			{bus: b2, addr: 0x293ce10457784c2a},
+		},
+	}
+
+	rs := ds.ReadAll(context.Background())
+	if b1.conversions != 1 || b2.conversions != 1 {
+		t.Errorf("conversions = %d, %d; want 1 per bus", b1.conversions, b2.conversions)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(rs))
+	}
+	for i, want := range []float64{24.5, 25} {
+		if rs[i].Err != nil {
+			t.Fatalf("at index %d: unexpected error %v", i, rs[i].Err)
+		}
+		if rs[i].Env.Temperature != want {
+			t.Errorf("at index %d: Temperature = %v; want %v", i, rs[i].Env.Temperature, want)
+		}
+	}
+	if rs[2].Err == nil {
+		t.Errorf("expected an error for a device that did not respond")
+	}
+}
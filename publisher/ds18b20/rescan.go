@@ -0,0 +1,125 @@
+package ds18b20
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/rs/zerolog/log"
+	"periph.io/x/conn/v3/onewire"
+)
+
+// Rescan searches every bus again. Probes that appeared are opened and
+// reported as sensor.Added, probes that are no longer found are marked offline
+// and reported as sensor.Removed; an offline probe found again, on any bus, is
+// reported as added and read again. Probes offline for longer than
+// Config.OfflineRetention are dropped.
+func (ds *Devs) Rescan() ([]sensor.Event, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var firstErr error
+	searched := map[bus]bool{}         // buses whose search succeeded
+	found := map[onewire.Address]bus{} // bus each probe was found on
+	var order []onewire.Address        // probes in the order they were found
+	for _, b := range ds.buses {
+		addrs, err := b.search()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		searched[b] = true
+		for _, addr := range addrs {
+			if _, ok := found[addr]; !ok {
+				found[addr] = b
+				order = append(order, addr)
+			}
+		}
+	}
+
+	var evs []sensor.Event
+	known := map[onewire.Address]bool{}
+	for i := range ds.devs {
+		d := &ds.devs[i]
+		known[d.addr] = true
+		_, offline := ds.offline[d.addr]
+		b, ok := found[d.addr]
+		if ok && b != d.bus {
+			// Moved to another bus
+			if err := b.open(d.addr); err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("device %x: %w", d.addr, err)
+				}
+				continue
+			}
+			d.bus = b
+		}
+		switch {
+		case ok && offline:
+			log.Info().Msgf("1wire device %v is back", d)
+			delete(ds.offline, d.addr)
+			evs = append(evs, sensor.Event{Type: sensor.Added, Sensor: d})
+		case !ok && !offline && searched[d.bus]:
+			log.Info().Msgf("1wire device %v removed", d)
+			if ds.offline == nil {
+				ds.offline = map[onewire.Address]time.Time{}
+			}
+			ds.offline[d.addr] = ds.now()
+			evs = append(evs, sensor.Event{Type: sensor.Removed, Sensor: d})
+		}
+	}
+
+	for _, addr := range order {
+		if known[addr] || !ds.cfg.permits(addr) {
+			continue
+		}
+		b := found[addr]
+		if err := b.open(addr); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("device %x: %w", addr, err)
+			}
+			continue
+		}
+		log.Info().Msgf("1wire device %x added", addr)
+		ds.devs = append(ds.devs, ds.newDev(b, addr))
+		evs = append(evs, sensor.Event{Type: sensor.Added, Sensor: &ds.devs[len(ds.devs)-1]})
+	}
+
+	ds.forget()
+	return evs, firstErr
+}
+
+// forget drops the probes offline for longer than the retention period so
+// that probes swapped over time do not accumulate. The remaining ones are
+// copied to a new slice as the events and results already handed out point
+// into the current one.
+func (ds *Devs) forget() {
+	now, retention := ds.now(), ds.cfg.offlineRetention()
+	expired := func(addr onewire.Address) bool {
+		since, ok := ds.offline[addr]
+		return ok && now.Sub(since) > retention
+	}
+
+	var gone int
+	for addr := range ds.offline {
+		if expired(addr) {
+			gone++
+		}
+	}
+	if gone == 0 {
+		return
+	}
+	devs := make([]Dev, 0, len(ds.devs)-gone)
+	for i := range ds.devs {
+		d := &ds.devs[i]
+		if expired(d.addr) {
+			log.Info().Msgf("1wire device %v forgotten after being offline since %s", d, ds.offline[d.addr].Format(time.RFC3339))
+			delete(ds.offline, d.addr)
+			continue
+		}
+		devs = append(devs, *d)
+	}
+	ds.devs = devs
+}
@@ -0,0 +1,139 @@
+package ds18b20
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestRescan(t *testing.T) {
+	ds, err := Open(Config{Backend: BackendSim, Sim: SimConfig{Probes: 2, Baseline: 25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ds.buses[0].(*simBus)
+
+	evs, err := ds.Rescan()
+	if err != nil || len(evs) != 0 {
+		t.Fatalf("Rescan() = %v, %v; want no events", evs, err)
+	}
+
+	// Replace the second probe with a new one.
+	b.addrs = []onewire.Address{simAddress(1), simAddress(3)}
+	evs, err = ds.Rescan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ  sensor.EventType
+		addr onewire.Address
+	}{
+		{sensor.Removed, simAddress(2)},
+		{sensor.Added, simAddress(3)},
+	}
+	if len(evs) != len(want) {
+		t.Fatalf("Rescan() = %v; want %d events", evs, len(want))
+	}
+	for i, w := range want {
+		if evs[i].Type != w.typ || evs[i].Sensor.ID() != (&Dev{addr: w.addr}).String() {
+			t.Errorf("event %d = %s %s; want %s %x", i, evs[i].Type, evs[i].Sensor.ID(), w.typ, w.addr)
+		}
+	}
+
+	rs := ds.ReadAll(context.Background())
+	if len(rs) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(rs))
+	}
+	if rs[0].Err != nil || rs[2].Err != nil {
+		t.Errorf("unexpected errors: %v, %v", rs[0].Err, rs[2].Err)
+	}
+	if !errors.Is(rs[1].Err, sensor.ErrOffline) {
+		t.Errorf("Err = %v; want %v", rs[1].Err, sensor.ErrOffline)
+	}
+
+	// The removed probe comes back.
+	b.addrs = []onewire.Address{simAddress(1), simAddress(2), simAddress(3)}
+	evs, err = ds.Rescan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 1 || evs[0].Type != sensor.Added || evs[0].Sensor.ID() != (&Dev{addr: simAddress(2)}).String() {
+		t.Errorf("Rescan() = %v; want %x added", evs, simAddress(2))
+	}
+	if err := ds.ReadAll(context.Background())[1].Err; err != nil {
+		t.Errorf("unexpected error after the probe came back: %v", err)
+	}
+}
+
+func TestRescanMovedProbe(t *testing.T) {
+	ds, err := Open(Config{Backend: BackendSim, Sim: SimConfig{Probes: 2, Baseline: 25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1 := ds.buses[0].(*simBus)
+	b2 := newSimBus(SimConfig{Baseline: 25}, DefaultResolution)
+	ds.buses = append(ds.buses, b2)
+
+	// The second probe is plugged into the other bus.
+	b1.addrs = []onewire.Address{simAddress(1)}
+	b2.addrs = []onewire.Address{simAddress(2)}
+	evs, err := ds.Rescan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 0 {
+		t.Errorf("Rescan() = %v; want no events", evs)
+	}
+	if devs := ds.GetDevs(); len(devs) != 2 || devs[1].bus != b2 {
+		t.Fatalf("GetDevs() = %v; want the second probe on the other bus", devs)
+	}
+	for _, r := range ds.ReadAll(context.Background()) {
+		if r.Err != nil {
+			t.Errorf("unexpected error: %v", r.Err)
+		}
+	}
+}
+
+func TestRescanForget(t *testing.T) {
+	ds, err := Open(Config{Backend: BackendSim, Sim: SimConfig{Probes: 2, Baseline: 25}, OfflineRetention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ds.buses[0].(*simBus)
+	now := time.Now()
+	ds.now = func() time.Time { return now }
+
+	b.addrs = []onewire.Address{simAddress(1)}
+	if _, err := ds.Rescan(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ds.GetDevs()); n != 2 {
+		t.Fatalf("expected 2 devices while the probe is kept, got %d", n)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	evs, err := ds.Rescan()
+	if err != nil || len(evs) != 0 {
+		t.Fatalf("Rescan() = %v, %v; want no events", evs, err)
+	}
+	if devs := ds.GetDevs(); len(devs) != 1 || devs[0].addr != simAddress(1) {
+		t.Errorf("GetDevs() = %v; want only %x", devs, simAddress(1))
+	}
+	if len(ds.offline) != 0 {
+		t.Errorf("offline = %v; want none", ds.offline)
+	}
+
+	// A forgotten probe plugged in again is added anew.
+	b.addrs = []onewire.Address{simAddress(1), simAddress(2)}
+	evs, err = ds.Rescan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 1 || evs[0].Type != sensor.Added || evs[0].Sensor.ID() != (&Dev{addr: simAddress(2)}).String() {
+		t.Errorf("Rescan() = %v; want %x added", evs, simAddress(2))
+	}
+}
@@ -0,0 +1,52 @@
+package ds18b20
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/backoff"
+)
+
+// RetryPolicy controls how long a read may take and how failed reads are retried.
+type RetryPolicy struct {
+	Timeout     time.Duration   // limit for a read including its retries; 0 means none
+	MaxAttempts int             // attempts including the first one; 0 is treated as 1
+	Backoff     backoff.Backoff // delay between attempts
+}
+
+// DefaultRetry is the policy used by New.
+var DefaultRetry = RetryPolicy{
+	Timeout:     10 * time.Second,
+	MaxAttempts: 3,
+	Backoff:     backoff.Backoff{Base: 100 * time.Millisecond, Max: 2 * time.Second},
+}
+
+func (p RetryPolicy) validate() error {
+	if p.Timeout < 0 {
+		return fmt.Errorf("ds18b20: read timeout must not be negative (is %s)", p.Timeout)
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("ds18b20: max attempts must not be negative (is %d)", p.MaxAttempts)
+	}
+	if p.Backoff.Base < 0 || p.Backoff.Max < 0 {
+		return fmt.Errorf("ds18b20: retry delays must not be negative (are %s and %s)", p.Backoff.Base, p.Backoff.Max)
+	}
+	return nil
+}
+
+// attempts returns the number of attempts allowed.
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// withTimeout derives the context bounding a read.
+func (p RetryPolicy) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.Timeout)
+}
@@ -0,0 +1,93 @@
+package ds18b20
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/backoff"
+)
+
+func TestReadRetries(t *testing.T) {
+	b := &sequenceBus{temps: []float64{85, -127, 24.5}}
+	d := Dev{bus: b, addr: 0x293ce10457784c28, retry: RetryPolicy{MaxAttempts: 3}}
+
+	e, err := d.Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Temperature != 24.5 || b.conversions != 3 {
+		t.Errorf("Read() = %v after %d conversions; want 24.5 after 3", e.Temperature, b.conversions)
+	}
+
+	b = &sequenceBus{temps: []float64{85}}
+	d = Dev{bus: b, addr: 0x293ce10457784c28, retry: RetryPolicy{MaxAttempts: 2}}
+	_, err = d.Read(context.Background())
+	var re *ReadingError
+	if !errors.As(err, &re) || b.conversions != 2 {
+		t.Errorf("Read() = %v after %d conversions; want a *ReadingError after 2", err, b.conversions)
+	}
+}
+
+func TestReadCanceled(t *testing.T) {
+	d := Dev{
+		bus:   &sequenceBus{temps: []float64{85}},
+		addr:  0x293ce10457784c28,
+		retry: RetryPolicy{MaxAttempts: 5, Backoff: backoff.Backoff{Base: time.Minute}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := d.Read(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() = %v; want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Read() did not return on cancellation")
+	}
+}
+
+func TestReadAllTimeout(t *testing.T) {
+	ds := &Devs{
+		devs: []Dev{{bus: &sequenceBus{temps: []float64{85}}, addr: 0x293ce10457784c28}},
+		retry: RetryPolicy{
+			Timeout:     10 * time.Millisecond,
+			MaxAttempts: 5,
+			Backoff:     backoff.Backoff{Base: time.Minute},
+		},
+	}
+
+	start := time.Now()
+	r := ds.ReadAll(context.Background())[0]
+	var re *ReadingError
+	if !errors.As(r.Err, &re) {
+		t.Errorf("Err = %v; want the last *ReadingError", r.Err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("ReadAll() did not honour the timeout")
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     RetryPolicy
+		isErr bool
+	}{
+		{name: "default", p: DefaultRetry},
+		{name: "zero", p: RetryPolicy{}},
+		{name: "negative timeout", p: RetryPolicy{Timeout: -1}, isErr: true},
+		{name: "negative attempts", p: RetryPolicy{MaxAttempts: -1}, isErr: true},
+		{name: "negative delay", p: RetryPolicy{Backoff: backoff.Backoff{Base: -1}}, isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.validate(); (err != nil) != tt.isErr {
+				t.Errorf("validate() = %v; want error: %t", err, tt.isErr)
+			}
+		})
+	}
+}
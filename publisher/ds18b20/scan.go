@@ -0,0 +1,50 @@
+package ds18b20
+
+import (
+	"io"
+
+	"periph.io/x/conn/v3/onewire"
+)
+
+// Found is a device answering the search of a bus.
+type Found struct {
+	Address   onewire.Address
+	Permitted bool // passes the allow and deny lists, i.e. would be opened by Open
+}
+
+// Family returns the 1-wire family code of the device; 0x28 is a DS18B20.
+func (f Found) Family() byte {
+	return byte(f.Address)
+}
+
+// Scan searches every bus selected by cfg and returns the devices found, without
+// opening them. Unlike Open, devices excluded by the allow and deny lists are
+// returned too.
+func Scan(cfg Config) ([]Found, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	bs, err := newBuses(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, b := range bs {
+			if c, ok := b.(io.Closer); ok {
+				_ = c.Close()
+			}
+		}
+	}()
+
+	var fs []Found
+	for _, b := range bs {
+		addrs, err := b.search()
+		if err != nil {
+			return fs, err
+		}
+		for _, addr := range addrs {
+			fs = append(fs, Found{Address: addr, Permitted: cfg.permits(addr)})
+		}
+	}
+	return fs, nil
+}
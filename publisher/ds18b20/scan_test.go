@@ -0,0 +1,27 @@
+package ds18b20
+
+import (
+	"testing"
+
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestScan(t *testing.T) {
+	a, b := simAddress(1), simAddress(2)
+	fs, err := Scan(Config{Backend: BackendSim, Sim: SimConfig{Addrs: []onewire.Address{a, b}}, Deny: []onewire.Address{b}, Retry: DefaultRetry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Found{{Address: a, Permitted: true}, {Address: b, Permitted: false}}
+	if len(fs) != len(want) {
+		t.Fatalf("got %d devices, want %d", len(fs), len(want))
+	}
+	for i, f := range fs {
+		if f != want[i] {
+			t.Errorf("at index %d: got %+v, want %+v", i, f, want[i])
+		}
+		if f.Family() != 0x28 {
+			t.Errorf("at index %d: Family() = %#x; want 0x28", i, f.Family())
+		}
+	}
+}
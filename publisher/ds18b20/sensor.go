@@ -0,0 +1,87 @@
+package ds18b20
+
+import (
+	"context"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// unitCelsius is the SenML/UCUM symbol for degrees Celsius.
+const unitCelsius = "Cel"
+
+// Measurements implements sensor.Reading.
+func (e Env) Measurements() []sensor.Measurement {
+	return []sensor.Measurement{{Kind: sensor.Temperature, Value: e.Temperature, Unit: unitCelsius}}
+}
+
+// Time implements sensor.Reading.
+func (e Env) Time() time.Time {
+	return e.Timestamp
+}
+
+// Stats implements sensor.Summary.
+func (e Env) Stats() *sensor.Stats {
+	return e.Window
+}
+
+// WithStats implements sensor.Summary.
+func (e Env) WithStats(st sensor.Stats) sensor.Reading {
+	e.Window = &st
+	return e
+}
+
+// ID implements sensor.Sensor; the 1-wire address is used as the identity.
+func (d *Dev) ID() string {
+	return d.String()
+}
+
+// Meta implements sensor.Describer.
+func (d *Dev) Meta() sensor.Meta {
+	return d.meta
+}
+
+// Kind implements sensor.Sensor.
+func (d *Dev) Kind() sensor.Kind {
+	return sensor.Temperature
+}
+
+// Sample implements sensor.Sensor.
+func (d *Dev) Sample(ctx context.Context) (sensor.Reading, error) {
+	e, err := d.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Sensors implements sensor.Source.
+func (ds *Devs) Sensors() []sensor.Sensor {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	ss := make([]sensor.Sensor, 0, len(ds.devs))
+	for i := range ds.devs {
+		ss = append(ss, &ds.devs[i])
+	}
+	return ss
+}
+
+// SampleAll implements sensor.BatchSampler.
+func (ds *Devs) SampleAll(ctx context.Context) []sensor.Result {
+	var rs []sensor.Result
+	for _, r := range ds.ReadAll(ctx) {
+		sr := sensor.Result{Sensor: r.Dev, Err: r.Err}
+		if r.Err == nil {
+			sr.Reading = r.Env
+		}
+		rs = append(rs, sr)
+	}
+	return rs
+}
+
+var _ sensor.Summary = Env{}
+var _ sensor.Sensor = &Dev{}
+var _ sensor.Describer = &Dev{}
+var _ sensor.Source = &Devs{}
+var _ sensor.BatchSampler = &Devs{}
+var _ sensor.Rescanner = &Devs{}
@@ -0,0 +1,93 @@
+package ds18b20
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/onewire"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/devices/v3/ds18b20"
+)
+
+// SimConfig describes the virtual probes produced by the simulated backend.
+type SimConfig struct {
+	Probes      int               // number of virtual probes, used when Addrs is empty
+	Addrs       []onewire.Address // addresses of the virtual probes
+	Baseline    float64           // temperature in °C at start up
+	Drift       float64           // °C per hour added to the baseline
+	Noise       float64           // standard deviation of the noise in °C
+	FailureRate float64           // probability (0..1) that a read fails
+	Seed        int64             // random seed; 0 seeds from the current time
+}
+
+// simBus is a bus backend that fabricates readings.
+type simBus struct {
+	cfg        SimConfig
+	resolution int
+	addrs      []onewire.Address
+	start      time.Time
+	now        func() time.Time
+
+	mu  sync.Mutex // protects rnd
+	rnd *rand.Rand
+}
+
+func newSimBus(cfg SimConfig, resolution int) *simBus {
+	addrs := cfg.Addrs
+	if len(addrs) == 0 {
+		for i := 0; i < cfg.Probes; i++ {
+			addrs = append(addrs, simAddress(uint64(i+1)))
+		}
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &simBus{
+		cfg:        cfg,
+		resolution: resolution,
+		addrs:      addrs,
+		start:      time.Now(),
+		now:        time.Now,
+		rnd:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+// simAddress builds a valid DS18B20 address (family code, serial and CRC) from a serial number.
+func simAddress(serial uint64) onewire.Address {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], serial<<8)
+	b[0] = byte(ds18b20.DS18B20)
+	b[7] = onewire.CalcCRC(b[:7])
+	return onewire.Address(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (b *simBus) search() ([]onewire.Address, error) {
+	return b.addrs, nil
+}
+
+func (b *simBus) open(onewire.Address) error {
+	return nil
+}
+
+func (b *simBus) convertAll() error {
+	return nil
+}
+
+func (b *simBus) lastTemp(addr onewire.Address) (physic.Temperature, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rnd.Float64() < b.cfg.FailureRate {
+		return 0, fmt.Errorf("ds18b20: simulated failure on %x", addr)
+	}
+	c := b.cfg.Baseline + b.cfg.Drift*b.now().Sub(b.start).Hours() + b.rnd.NormFloat64()*b.cfg.Noise
+	// The DS18B20 reports in steps of 0.5°C at 9 bits down to 1/16°C at 12 bits.
+	steps := float64(int(2) << uint(b.resolution-9))
+	c = math.Round(c*steps) / steps
+	return physic.Temperature(c*float64(physic.Celsius)) + physic.ZeroCelsius, nil
+}
@@ -0,0 +1,92 @@
+package ds18b20
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestSimAddress(t *testing.T) {
+	a := simAddress(1)
+	if family := a & 0xff; family != 0x28 {
+		t.Errorf("family = %#x; want 0x28", family)
+	}
+	var b [8]byte
+	for i := range b {
+		b[i] = byte(a >> (8 * i))
+	}
+	if !onewire.CheckCRC(b[:]) {
+		t.Errorf("address %x has an invalid CRC", a)
+	}
+}
+
+func TestOpenSim(t *testing.T) {
+	ds, err := Open(Config{Backend: BackendSim, Sim: SimConfig{Probes: 3, Baseline: 25, Seed: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs := ds.GetDevs()
+	if len(devs) != 3 {
+		t.Fatalf("expected 3 devices, got %d", len(devs))
+	}
+	e, err := devs[0].Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Temperature != 25 {
+		t.Errorf("Temperature = %v; want 25", e.Temperature)
+	}
+}
+
+func TestSimBus(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SimConfig
+		elapsed time.Duration
+		want    float64
+		isErr   bool
+	}{
+		{
+			name: "baseline",
+			cfg:  SimConfig{Addrs: []onewire.Address{0x293ce10457784c28}, Baseline: 24.5},
+			want: 24.5,
+		},
+		{
+			name:    "drift",
+			cfg:     SimConfig{Addrs: []onewire.Address{0x293ce10457784c28}, Baseline: 24, Drift: 0.5},
+			elapsed: 2 * time.Hour,
+			want:    25,
+		},
+		{
+			name:  "failure",
+			cfg:   SimConfig{Addrs: []onewire.Address{0x293ce10457784c28}, FailureRate: 1},
+			isErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newSimBus(tt.cfg, 12)
+			b.now = func() time.Time { return b.start.Add(tt.elapsed) }
+			addrs, err := b.search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := b.lastTemp(addrs[0])
+			if tt.isErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Celsius() != tt.want {
+				t.Errorf("lastTemp() = %v; want %v", got.Celsius(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package ds18b20
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"periph.io/x/conn/v3/onewire"
+	"periph.io/x/conn/v3/physic"
+)
+
+// DefaultSysfsRoot is where the w1 kernel subsystem exposes the 1-wire devices.
+const DefaultSysfsRoot = "/sys/bus/w1/devices"
+
+// thermFamilies are the family codes handled by the w1_therm kernel driver.
+var thermFamilies = map[byte]bool{
+	0x10: true, // DS18S20
+	0x22: true, // DS1822
+	0x28: true, // DS18B20
+	0x3b: true, // DS1825
+	0x42: true, // DS28EA00
+}
+
+// sysfsBus reads the probes through the files exposed by the w1_therm kernel driver.
+type sysfsBus struct {
+	root       string
+	master     int // w1_bus_master number; 0 covers every bus
+	resolution int
+	names      map[onewire.Address]string // address to device directory name
+
+	writeFile func(name string, data []byte, perm os.FileMode) error
+}
+
+func newSysfsBus(root string, master, resolution int) *sysfsBus {
+	if root == "" {
+		root = DefaultSysfsRoot
+	}
+	return &sysfsBus{root: root, master: master, resolution: resolution, names: map[onewire.Address]string{}, writeFile: os.WriteFile}
+}
+
+// masterDir returns the directory of the bus master, or the devices root when
+// every bus is used.
+func (b *sysfsBus) masterDir() string {
+	if b.master == 0 {
+		return b.root
+	}
+	return filepath.Join(b.root, fmt.Sprintf("w1_bus_master%d", b.master))
+}
+
+func (b *sysfsBus) search() ([]onewire.Address, error) {
+	entries, err := os.ReadDir(b.masterDir())
+	if err != nil {
+		return nil, err
+	}
+	var addrs []onewire.Address
+	for _, e := range entries {
+		addr, err := parseSysfsName(e.Name())
+		if err != nil || !thermFamilies[byte(addr)] {
+			continue
+		}
+		b.names[addr] = e.Name()
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// open sets the resolution of the probe. Kernels older than 5.9 do not expose
+// the resolution file, and only root may write it; in either case the probe
+// keeps its current setting.
+func (b *sysfsBus) open(addr onewire.Address) error {
+	p := filepath.Join(b.root, b.names[addr], "resolution")
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) == strconv.Itoa(b.resolution) {
+		return nil
+	}
+	if err := b.writeFile(p, []byte(strconv.Itoa(b.resolution)+"\n"), 0); err != nil {
+		log.Warn().Msgf("ds18b20: could not set the resolution of %x to %d bits, keeping %s bits: %s", addr, b.resolution, strings.TrimSpace(string(data)), err)
+	}
+	return nil
+}
+
+// convertAll triggers a bulk conversion when the kernel supports it; otherwise
+// the conversion happens when each probe is read.
+func (b *sysfsBus) convertAll() error {
+	pattern := filepath.Join(b.root, "w1_bus_master*", "therm_bulk_read")
+	if b.master != 0 {
+		pattern = filepath.Join(b.masterDir(), "therm_bulk_read")
+	}
+	triggers, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, t := range triggers {
+		if err := os.WriteFile(t, []byte("trigger\n"), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *sysfsBus) lastTemp(addr onewire.Address) (physic.Temperature, error) {
+	name, ok := b.names[addr]
+	if !ok {
+		return 0, fmt.Errorf("ds18b20: unknown device %x", addr)
+	}
+	dir := filepath.Join(b.root, name)
+
+	f, err := os.Open(filepath.Join(dir, "w1_slave"))
+	if err == nil {
+		defer f.Close()
+		return parseW1Slave(bufio.NewScanner(f))
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "temperature"))
+	if err != nil {
+		return 0, err
+	}
+	return parseMilliCelsius(strings.TrimSpace(string(data)))
+}
+
+// parseSysfsName converts a w1 device name such as "28-0316a2795aff" into its
+// 1-wire address. The kernel omits the CRC byte, so it is recomputed.
+func parseSysfsName(name string) (onewire.Address, error) {
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 12 {
+		return 0, fmt.Errorf("invalid w1 device name %q", name)
+	}
+	family, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid w1 device name %q: %w", name, err)
+	}
+	serial, err := strconv.ParseUint(parts[1], 16, 48)
+	if err != nil {
+		return 0, fmt.Errorf("invalid w1 device name %q: %w", name, err)
+	}
+	a := serial<<8 | family
+	var b [7]byte
+	for i := range b {
+		b[i] = byte(a >> (8 * i))
+	}
+	return onewire.Address(a | uint64(onewire.CalcCRC(b[:]))<<56), nil
+}
+
+// parseW1Slave parses the two line w1_slave format:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(s *bufio.Scanner) (physic.Temperature, error) {
+	if !s.Scan() {
+		return 0, errors.New("ds18b20: empty w1_slave")
+	}
+	crc := strings.TrimSpace(s.Text())
+	// The CRC of a blank scratchpad is 0 too, so it is accepted by the kernel
+	if strings.HasPrefix(crc, "00 00 00 00 00 00 00 00 00") {
+		return 0, errNoResponse
+	}
+	if !strings.HasSuffix(crc, "YES") {
+		if strings.HasPrefix(crc, "ff ff ff ff ff ff ff ff ff") {
+			return 0, errNoResponse
+		}
+		return 0, errors.New("ds18b20: incorrect scratchpad CRC")
+	}
+	if !s.Scan() {
+		return 0, errors.New("ds18b20: truncated w1_slave")
+	}
+	line := s.Text()
+	i := strings.LastIndex(line, "t=")
+	if i < 0 {
+		return 0, fmt.Errorf("ds18b20: no temperature in w1_slave line %q", line)
+	}
+	return parseMilliCelsius(line[i+2:])
+}
+
+// parseMilliCelsius parses a temperature expressed in thousandths of °C.
+func parseMilliCelsius(s string) (physic.Temperature, error) {
+	m, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ds18b20: invalid temperature %q: %w", s, err)
+	}
+	return physic.Temperature(m)*physic.MilliCelsius + physic.ZeroCelsius, nil
+}
@@ -0,0 +1,166 @@
+package ds18b20
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"periph.io/x/conn/v3/onewire"
+)
+
+// writeSysfs creates a fake w1 devices tree in a temporary directory.
+func writeSysfs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestParseSysfsName(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  uint64
+		isErr bool
+	}{
+		{name: "28-0316a2795aff", want: 0x0316a2795aff28},
+		{name: "10-000802b4ba0e", want: 0x000802b4ba0e10},
+		{name: "w1_bus_master1", isErr: true},
+		{name: "28-xyz", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSysfsName(tt.name)
+			if tt.isErr {
+				if err == nil {
+					t.Fatalf("expected error, got %x", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint64(got)&0xffffffffffffff != tt.want {
+				t.Errorf("parseSysfsName(%s) = %x; want %x with CRC", tt.name, got, tt.want)
+			}
+			var b [8]byte
+			for i := range b {
+				b[i] = byte(got >> (8 * i))
+			}
+			if !onewire.CheckCRC(b[:]) {
+				t.Errorf("address %x has an invalid CRC", got)
+			}
+		})
+	}
+}
+
+func TestSysfsBus(t *testing.T) {
+	root := writeSysfs(t, map[string]string{
+		"w1_bus_master1/therm_bulk_read": "0\n",
+		"28-0316a2795aff/w1_slave":       "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n",
+		"28-0316a2795b00/w1_slave":       "72 01 4b 46 7f ff 0e 10 00 : crc=57 NO\n72 01 4b 46 7f ff 0e 10 00 t=23125\n",
+		"28-0316a2795b01/temperature":    "-1062\n",
+		"28-0316a2795b01/resolution":     "10\n",
+		"28-0316a2795b02/w1_slave":       "00 00 4b 46 7f ff 10 10 69 : crc=69 YES\n00 00 4b 46 7f ff 10 10 69 t=0\n",
+		"28-0316a2795b03/w1_slave":       "00 00 00 00 00 00 00 00 00 : crc=00 YES\n00 00 00 00 00 00 00 00 00 t=0\n",
+		"3a-0000001a2b3c/state":          "\n",
+	})
+
+	b := newSysfsBus(root, 0, 12)
+	addrs, err := b.search()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 5 {
+		t.Fatalf("expected 5 probes, got %d", len(addrs))
+	}
+	for _, addr := range addrs {
+		if err := b.open(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "28-0316a2795b01", "resolution")); string(data) != "12\n" {
+		t.Errorf("resolution = %q; want 12", data)
+	}
+	if err := b.convertAll(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "w1_bus_master1", "therm_bulk_read")); string(data) != "trigger\n" {
+		t.Errorf("therm_bulk_read = %q; want trigger", data)
+	}
+
+	tests := []struct {
+		name  string
+		want  float64
+		isErr bool
+	}{
+		{name: "w1_slave", want: 23.125},
+		{name: "crc failure", isErr: true},
+		{name: "temperature", want: -1.062},
+		{name: "ice water", want: 0},
+		{name: "blank scratchpad", isErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.lastTemp(addrs[i])
+			if tt.isErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Celsius() != tt.want {
+				t.Errorf("lastTemp() = %v; want %v", got.Celsius(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSysfsBusMaster(t *testing.T) {
+	root := writeSysfs(t, map[string]string{
+		"w1_bus_master1/28-0316a2795aff/w1_slave": "",
+		"w1_bus_master2/28-0316a2795b00/w1_slave": "",
+		"28-0316a2795aff/w1_slave":                "",
+		"28-0316a2795b00/w1_slave":                "",
+	})
+
+	addrs, err := newSysfsBus(root, 2, 10).search()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || uint64(addrs[0])&0xffffffffffffff != 0x0316a2795b0028 {
+		t.Errorf("search() = %x; want only 28-0316a2795b00", addrs)
+	}
+}
+
+func TestSysfsBusResolutionNotWritable(t *testing.T) {
+	root := writeSysfs(t, map[string]string{
+		"28-0316a2795aff/w1_slave":   "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n",
+		"28-0316a2795aff/resolution": "12\n",
+	})
+
+	b := newSysfsBus(root, 0, 10)
+	b.writeFile = func(string, []byte, os.FileMode) error { return os.ErrPermission }
+	addrs, err := b.search()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The probe is used at the resolution it has.
+	if err := b.open(addrs[0]); err != nil {
+		t.Errorf("open() = %v; want no error", err)
+	}
+	if got, err := b.lastTemp(addrs[0]); err != nil || got.Celsius() != 23.125 {
+		t.Errorf("lastTemp() = %v, %v; want 23.125", got, err)
+	}
+}
@@ -0,0 +1,126 @@
+package ds18b20
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"periph.io/x/conn/v3/onewire"
+	"periph.io/x/conn/v3/physic"
+)
+
+// Status classifies a reading returned by a probe.
+type Status int
+
+const (
+	StatusValid        Status = iota // plausible temperature
+	StatusPowerOnReset               // 85°C: no conversion since a brown-out
+	StatusOutOfRange                 // outside the -55°C to +125°C operating range
+	StatusCRCFailure                 // scratchpad CRC mismatch
+	StatusDisconnected               // no answer, the -127°C value or the blank scratchpad of a floating bus
+)
+
+// Limits of the DS18B20 operating range and the values it reports when it is
+// not working properly (datasheet p.1 and p.6).
+const (
+	minCelsius          = -55
+	maxCelsius          = 125
+	powerOnResetCelsius = 85
+	disconnectedCelsius = -127
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusValid:
+		return "valid"
+	case StatusPowerOnReset:
+		return "power-on-reset"
+	case StatusOutOfRange:
+		return "out-of-range"
+	case StatusCRCFailure:
+		return "crc-failure"
+	case StatusDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// ReadingError is returned when a probe answered with a reading that must not
+// be published.
+type ReadingError struct {
+	Addr        onewire.Address
+	Status      Status
+	Temperature float64 // raw value in °C when the status was derived from it
+	Err         error   // error reported by the backend, if any
+}
+
+func (e *ReadingError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("device %x: %s reading: %s", e.Addr, e.Status, e.Err)
+	}
+	return fmt.Sprintf("device %x: %s reading (%.3f°C)", e.Addr, e.Status, e.Temperature)
+}
+
+func (e *ReadingError) Unwrap() error {
+	return e.Err
+}
+
+// errNoResponse is reported when the scratchpad shows that no probe answered.
+var errNoResponse = errors.New("ds18b20: device did not respond")
+
+// blankScratchpad reports whether a scratchpad reads all zeros, as it does when
+// the data line is held low. A probe never returns it: the configuration
+// register and byte 5 always have bits set (datasheet p.7 and p.9), so a
+// reading of 0°C is only discarded when its scratchpad is blank.
+func blankScratchpad(spad []byte) bool {
+	for _, b := range spad {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// classify returns the status of a value or error returned by bus.lastTemp.
+// Errors that do not denote a bad reading are reported as StatusValid and must
+// be handled by the caller.
+func classify(temp physic.Temperature, err error) Status {
+	if err != nil {
+		// periph.io and the kernel only report these as strings.
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "has not performed a temperature conversion"):
+			return StatusPowerOnReset
+		case strings.Contains(msg, "incorrect scratchpad CRC"):
+			return StatusCRCFailure
+		case strings.Contains(msg, "did not respond"):
+			return StatusDisconnected
+		}
+		return StatusValid
+	}
+	c := temp.Celsius()
+	switch {
+	case c == powerOnResetCelsius:
+		return StatusPowerOnReset
+	case c == disconnectedCelsius:
+		return StatusDisconnected
+	case c < minCelsius || c > maxCelsius:
+		return StatusOutOfRange
+	}
+	return StatusValid
+}
+
+// validate turns the result of bus.lastTemp into a *ReadingError when the
+// reading is not usable.
+func validate(addr onewire.Address, temp physic.Temperature, err error) error {
+	s := classify(temp, err)
+	if s == StatusValid {
+		return err
+	}
+	re := &ReadingError{Addr: addr, Status: s, Err: err}
+	if err == nil {
+		re.Temperature = temp.Celsius()
+	}
+	return re
+}
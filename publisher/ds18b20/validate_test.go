@@ -0,0 +1,134 @@
+package ds18b20
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"periph.io/x/conn/v3/onewire"
+	"periph.io/x/conn/v3/physic"
+)
+
+func celsius(c float64) physic.Temperature {
+	return physic.Temperature(c*float64(physic.Celsius)) + physic.ZeroCelsius
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		temp physic.Temperature
+		err  error
+		want Status
+	}{
+		{name: "valid", temp: celsius(24.5), want: StatusValid},
+		{name: "valid negative", temp: celsius(-10.25), want: StatusValid},
+		{name: "power-on reset value", temp: celsius(85), want: StatusPowerOnReset},
+		{name: "power-on reset error", err: errors.New("ds18b20: has not performed a temperature conversion (insufficient pull-up?)"), want: StatusPowerOnReset},
+		{name: "crc error", err: errors.New("ds18b20: incorrect scratchpad CRC"), want: StatusCRCFailure},
+		{name: "no response", err: errors.New("ds18b20: device did not respond"), want: StatusDisconnected},
+		{name: "-127", temp: celsius(-127), want: StatusDisconnected},
+		{name: "zero", temp: celsius(0), want: StatusValid},
+		{name: "too hot", temp: celsius(125.5), want: StatusOutOfRange},
+		{name: "too cold", temp: celsius(-60), want: StatusOutOfRange},
+		{name: "other error", err: errors.New("netlink: socket closed"), want: StatusValid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.temp, tt.err); got != tt.want {
+				t.Errorf("classify() = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlankScratchpad(t *testing.T) {
+	tests := []struct {
+		name string
+		spad []byte
+		want bool
+	}{
+		{name: "floating bus", spad: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0}, want: true},
+		{name: "0°C", spad: []byte{0x00, 0x00, 0x4b, 0x46, 0x7f, 0xff, 0x10, 0x10, 0x69}, want: false},
+		{name: "23.125°C", spad: []byte{0x72, 0x01, 0x4b, 0x46, 0x7f, 0xff, 0x0e, 0x10, 0x57}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blankScratchpad(tt.spad); got != tt.want {
+				t.Errorf("blankScratchpad() = %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := validate(0x293ce10457784c28, celsius(85), nil)
+	var re *ReadingError
+	if !errors.As(err, &re) {
+		t.Fatalf("validate() = %v; want a *ReadingError", err)
+	}
+	if re.Status != StatusPowerOnReset || re.Temperature != 85 {
+		t.Errorf("validate() = %+v; want power-on-reset at 85°C", re)
+	}
+
+	other := errors.New("netlink: socket closed")
+	if err := validate(0x293ce10457784c28, 0, other); err != other {
+		t.Errorf("validate() = %v; want %v", err, other)
+	}
+}
+
+// sequenceBus returns the given temperatures one conversion after another.
+type sequenceBus struct {
+	temps       []float64
+	conversions int
+}
+
+func (b *sequenceBus) search() ([]onewire.Address, error) { return nil, nil }
+func (b *sequenceBus) open(onewire.Address) error         { return nil }
+func (b *sequenceBus) convertAll() error {
+	b.conversions++
+	return nil
+}
+func (b *sequenceBus) lastTemp(onewire.Address) (physic.Temperature, error) {
+	i := b.conversions - 1
+	if i >= len(b.temps) {
+		i = len(b.temps) - 1
+	}
+	return celsius(b.temps[i]), nil
+}
+
+func TestReadAllRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		temps    []float64
+		attempts int
+		want     float64
+		status   Status
+	}{
+		{name: "valid", temps: []float64{24.5}, attempts: 3, want: 24.5},
+		{name: "recovers after power-on reset", temps: []float64{85, 24.5}, attempts: 3, want: 24.5},
+		{name: "keeps failing", temps: []float64{85, 85, -127}, attempts: 3, status: StatusDisconnected},
+		{name: "single attempt", temps: []float64{85, 24.5}, attempts: 1, status: StatusPowerOnReset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &Devs{devs: []Dev{{bus: &sequenceBus{temps: tt.temps}, addr: 0x293ce10457784c28}}, retry: RetryPolicy{MaxAttempts: tt.attempts}}
+			r := ds.ReadAll(context.Background())[0]
+			if tt.status == StatusValid {
+				if r.Err != nil {
+					t.Fatal(r.Err)
+				}
+				if r.Env.Temperature != tt.want {
+					t.Errorf("Temperature = %v; want %v", r.Env.Temperature, tt.want)
+				}
+				return
+			}
+			var re *ReadingError
+			if !errors.As(r.Err, &re) || re.Status != tt.status {
+				t.Errorf("Err = %v; want %s", r.Err, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/sensor"
+)
+
+// event is the payload announcing that a probe was plugged in or removed
+type event struct {
+	Event sensor.EventType `json:"event"`
+	ID    string           `json:"id"`
+	sensor.Meta
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// newEvent builds the payload of a sensor event
+func newEvent(e sensor.Event, now time.Time) event {
+	ev := event{Event: e.Type, ID: e.Sensor.ID(), Timestamp: now}
+	if d, ok := e.Sensor.(sensor.Describer); ok {
+		ev.Meta = d.Meta()
+	}
+	return ev
+}
+
+// eventTopic returns the topic events about s are published on, next to its readings
+func eventTopic(t topics, s sensor.Sensor) string {
+	return strings.Join([]string{t.reading(s), "event"}, "/")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/topic"
+	"periph.io/x/conn/v3/onewire"
+)
+
+func TestNewEvent(t *testing.T) {
+	ds, err := ds18b20.Open(ds18b20.Config{
+		Backend: ds18b20.BackendSim,
+		Sim:     ds18b20.SimConfig{Addrs: []onewire.Address{0x293ce10457784c28}},
+		Meta:    map[onewire.Address]sensor.Meta{0x293ce10457784c28: {Alias: "sump"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ds.Sensors()[0]
+
+	msg, err := json.Marshal(newEvent(sensor.Event{Type: sensor.Removed, Sensor: s}, time.Unix(0, 0).UTC()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"event":"removed","id":"293ce10457784c28","alias":"sump","timestamp":"1970-01-01T00:00:00Z"}`
+	if string(msg) != want {
+		t.Errorf("unexpected value: got: %s, want: %s", msg, want)
+	}
+	tmpl, err := topic.Parse(defaultTopicTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventTopic(newTopics(config{topic: "sensors/pi", topicTemplate: tmpl}, "pi"), s); got != "sensors/pi/sump/event" {
+		t.Errorf("unexpected value: got: %s, want: sensors/pi/sump/event", got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/lupinthe14th/acm/publisher/spool"
+	"github.com/rs/zerolog/log"
+)
+
+// dropPolicy decides what happens to a message when the publish queue is full
+type dropPolicy string
+
+const (
+	dropOldest dropPolicy = "drop-oldest" // discard the message that has been waiting longest
+	dropNewest dropPolicy = "drop-newest" // discard the message being queued
+	dropNone   dropPolicy = "block"       // wait until there is room, holding up sampling
+)
+
+// broker is the part of autopaho.ConnectionManager the forwarder uses
+type broker interface {
+	AwaitConnection(ctx context.Context) error
+	Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error)
+}
+
+// forwarder publishes messages through a bounded queue served by a fixed number of workers. When a spool is
+// configured, messages that cannot be sent because the broker is unreachable are stored on disk and replayed in
+// order once the connection comes back.
+type forwarder struct {
+	cm           broker
+	q            *spool.Queue // nil when store-and-forward is disabled
+	retryDelay   time.Duration
+	printMessage bool
+	policy       dropPolicy
+
+	queue   chan spool.Message
+	mu      sync.RWMutex    // held for reading whilst a message is being queued, for writing when the workers stop
+	closed  bool            // set once the workers stopped; no more messages are queued
+	dropped uint64          // messages discarded because the queue was full; accessed atomically
+	wg      *sync.WaitGroup // counts the messages queued or being published
+	wake    chan struct{}   // signals the replay loop that a message was spooled
+}
+
+func newForwarder(cm broker, q *spool.Queue, cfg config, wg *sync.WaitGroup) *forwarder {
+	return &forwarder{
+		cm:           cm,
+		q:            q,
+		retryDelay:   cfg.connectRetryDelay,
+		printMessage: cfg.printMessage,
+		policy:       cfg.publishDropPolicy,
+		queue:        make(chan spool.Message, cfg.publishQueueDepth),
+		wg:           wg,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// start runs n workers publishing the queued messages until ctx is done. Messages still queued then are spooled
+// if possible, otherwise lost. With a spool a single worker is run, as concurrent failures would spool the
+// messages out of order.
+func (f *forwarder) start(ctx context.Context, n int, workers *sync.WaitGroup) {
+	if f.q != nil && n > 1 {
+		log.Info().Msgf("publishing with a single worker rather than %d to keep the spool in order", n)
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case m := <-f.queue:
+					f.forward(ctx, m)
+				case <-ctx.Done():
+					f.close()
+					for {
+						select {
+						case m := <-f.queue:
+							if f.q != nil {
+								f.store(m)
+							}
+							f.wg.Done()
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+}
+
+// close stops further messages from being queued, waiting for those being queued to make it or be dropped
+func (f *forwarder) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+// forward publishes a queued message, spooling it if the broker cannot be reached
+func (f *forwarder) forward(ctx context.Context, m spool.Message) {
+	defer f.wg.Done()
+	// Keep the original order: whilst older messages are waiting in the spool new ones have to queue behind them
+	if f.q != nil && f.q.Len() > 0 {
+		f.store(m)
+		return
+	}
+	if err := f.send(ctx, m); err != nil {
+		log.Error().Err(err).Msg("error publishing")
+		if f.q != nil && ctx.Err() == nil {
+			f.store(m)
+		}
+	}
+}
+
+// publish queues m for the workers; what happens when the queue is full depends on the drop policy
+func (f *forwarder) publish(ctx context.Context, m spool.Message) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed || ctx.Err() != nil { // shutting down: nobody would take the message off the queue
+		if f.q != nil {
+			f.store(m)
+		} else {
+			log.Warn().Msgf("shutting down, dropped message for %s", m.Topic)
+		}
+		return
+	}
+
+	f.wg.Add(1)
+	for {
+		select {
+		case f.queue <- m:
+			return
+		default:
+		}
+
+		switch f.policy {
+		case dropNewest:
+			f.drop(m)
+			return
+		case dropOldest:
+			select {
+			case old := <-f.queue:
+				f.drop(old)
+			default: // a worker took one meanwhile
+			}
+		default:
+			select {
+			case f.queue <- m:
+			case <-ctx.Done():
+				f.drop(m)
+			}
+			return
+		}
+	}
+}
+
+// drop discards m, which was counted as queued
+func (f *forwarder) drop(m spool.Message) {
+	n := atomic.AddUint64(&f.dropped, 1)
+	log.Warn().Msgf("publish queue full, dropped message for %s (%d dropped so far)", m.Topic, n)
+	f.wg.Done()
+}
+
+// droppedCount returns the number of messages discarded because the queue was full
+func (f *forwarder) droppedCount() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// send publishes m, returning an error only if the message did not reach the broker
+func (f *forwarder) send(ctx context.Context, m spool.Message) error {
+	p := &paho.Publish{QoS: m.QoS, Retain: m.Retain, Topic: m.Topic, Payload: m.Payload}
+	if m.ContentType != "" {
+		p.Properties = &paho.PublishProperties{ContentType: m.ContentType}
+	}
+	pr, err := f.cm.Publish(ctx, p)
+	if err != nil {
+		return err
+	}
+	if pr != nil && pr.ReasonCode != 0 && pr.ReasonCode != 16 { // 16 = Server received message but there are no subscribers
+		log.Info().Msgf("reason code %d received", pr.ReasonCode)
+	} else if f.printMessage {
+		log.Info().Msgf("sent message: %s", p.Payload)
+	}
+	return nil
+}
+
+// store adds m to the spool and wakes the replay loop
+func (f *forwarder) store(m spool.Message) {
+	if err := f.q.Push(m); err != nil {
+		log.Error().Msgf("error spooling message: %s", err)
+		return
+	}
+	log.Debug().Msgf("spooled message for %s (%d queued)", m.Topic, f.q.Len())
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replay publishes spooled messages, oldest first, whenever the connection is up. It returns when ctx is done.
+func (f *forwarder) replay(ctx context.Context) {
+	for {
+		m, ok, err := f.q.Peek()
+		if err != nil {
+			log.Error().Msgf("error reading spool: %s", err)
+		}
+		if err != nil || !ok {
+			select {
+			case <-f.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := f.cm.AwaitConnection(ctx); err != nil { // Should only happen when context is canceled
+			return
+		}
+		if err := f.send(ctx, m); err != nil {
+			log.Error().Msgf("error replaying spooled message: %s", err)
+			select {
+			case <-time.After(f.retryDelay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := f.q.Remove(m.Seq); err != nil {
+			log.Error().Msgf("error removing message from spool: %s", err)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/lupinthe14th/acm/publisher/spool"
+)
+
+// fakeBroker records the publishes; Publish signals started and blocks until release is closed.
+type fakeBroker struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu        sync.Mutex
+	topics    []string
+	published []*paho.Publish
+}
+
+func (b *fakeBroker) AwaitConnection(context.Context) error { return nil }
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics = append(b.topics, p.Topic)
+	b.published = append(b.published, p)
+	return &paho.PublishResponse{}, nil
+}
+
+func TestForwarderDropPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      dropPolicy
+		wantDropped uint64
+		wantValue   []string // topics published once the broker catches up, in order
+	}{
+		{name: "drop newest case", policy: dropNewest, wantDropped: 2, wantValue: []string{"0", "1", "2"}},
+		{name: "drop oldest case", policy: dropOldest, wantDropped: 2, wantValue: []string{"0", "3", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b := newFakeBroker()
+			var wg, pool sync.WaitGroup
+			fw := newForwarder(b, nil, config{publishQueueDepth: 2, publishDropPolicy: tt.policy}, &wg)
+			fw.start(ctx, 1, &pool)
+
+			// The single worker takes the first message and blocks on the broker, two more fill the queue
+			fw.publish(ctx, spool.Message{Topic: "0"})
+			<-b.started
+			for _, topic := range []string{"1", "2", "3", "4"} {
+				fw.publish(ctx, spool.Message{Topic: topic})
+			}
+			if got := fw.droppedCount(); got != tt.wantDropped {
+				t.Errorf("unexpected dropped count: got: %d, want: %d", got, tt.wantDropped)
+			}
+
+			close(b.release)
+			wg.Wait()
+			if len(b.topics) != len(tt.wantValue) {
+				t.Fatalf("unexpected value: got: %v, want: %v", b.topics, tt.wantValue)
+			}
+			for i := range b.topics {
+				if b.topics[i] != tt.wantValue[i] {
+					t.Errorf("unexpected value: got: %v, want: %v", b.topics, tt.wantValue)
+				}
+			}
+			cancel()
+			pool.Wait()
+		})
+	}
+}
+
+func TestForwarderBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := newFakeBroker()
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(b, nil, config{publishQueueDepth: 1, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 1, &pool)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, topic := range []string{"0", "1", "2", "3"} {
+			fw.publish(ctx, spool.Message{Topic: topic})
+		}
+	}()
+	close(b.release)
+	<-done
+	wg.Wait()
+	if fw.droppedCount() != 0 || len(b.topics) != 4 {
+		t.Errorf("unexpected value: got: %v (%d dropped), want: 4 messages", b.topics, fw.droppedCount())
+	}
+
+	cancel()
+	pool.Wait()
+}
+
+func TestForwarderContentType(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := newFakeBroker()
+	close(b.release)
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(b, nil, config{publishQueueDepth: 2, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 1, &pool)
+	fw.publish(ctx, spool.Message{Topic: "0", ContentType: "application/cbor"})
+	fw.publish(ctx, spool.Message{Topic: "1"})
+	wg.Wait()
+
+	if len(b.published) != 2 {
+		t.Fatalf("unexpected value: got: %d messages, want: 2", len(b.published))
+	}
+	if p := b.published[0].Properties; p == nil || p.ContentType != "application/cbor" {
+		t.Errorf("unexpected value: got: %+v, want: content type application/cbor", p)
+	}
+	if p := b.published[1].Properties; p != nil && p.ContentType != "" {
+		t.Errorf("unexpected value: got: %q, want: no content type", p.ContentType)
+	}
+	cancel()
+	pool.Wait()
+}
+
+func TestForwarderShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Messages still queued when the connection is shut down are released
+	b := newFakeBroker()
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(b, nil, config{publishQueueDepth: 1, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 1, &pool)
+	fw.publish(ctx, spool.Message{Topic: "0"})
+	<-b.started
+	fw.publish(ctx, spool.Message{Topic: "1"})
+	cancel()
+	pool.Wait()
+	wg.Wait()
+	if len(b.topics) != 0 {
+		t.Errorf("unexpected value: got: %v, want: none", b.topics)
+	}
+}
+
+func TestForwarderClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A publish blocked on a full queue gives up when the connection is shut down, and later ones are refused
+	b := newFakeBroker()
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(b, nil, config{publishQueueDepth: 1, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 1, &pool)
+	fw.publish(ctx, spool.Message{Topic: "0"})
+	<-b.started
+	fw.publish(ctx, spool.Message{Topic: "1"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fw.publish(ctx, spool.Message{Topic: "2"})
+	}()
+	cancel()
+	<-done
+	pool.Wait()
+	fw.publish(ctx, spool.Message{Topic: "3"})
+	wg.Wait()
+	if len(fw.queue) != 0 {
+		t.Errorf("unexpected value: got: %d messages left in the queue, want: none", len(fw.queue))
+	}
+}
+
+// downBroker fails every publish as autopaho does whilst the connection is down
+type downBroker struct{}
+
+func (downBroker) AwaitConnection(context.Context) error { return nil }
+
+func (downBroker) Publish(context.Context, *paho.Publish) (*paho.PublishResponse, error) {
+	return nil, errors.New("connection down")
+}
+
+func TestForwarderSpoolOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := spool.Open(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(downBroker{}, q, config{publishQueueDepth: 100, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 4, &pool)
+	var want []string
+	for i := 0; i < 50; i++ {
+		want = append(want, strconv.Itoa(i))
+		fw.publish(ctx, spool.Message{Topic: want[i], Time: time.Now()})
+	}
+	wg.Wait()
+
+	var got []string
+	for {
+		m, ok, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, m.Topic)
+		if err := q.Remove(m.Seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected value: got: %v, want: %v", got, want)
+	}
+	cancel()
+	pool.Wait()
+}
+
+// flakyBroker is unreachable until up is closed, then records what is published along with the number of messages
+// still spooled at that time
+type flakyBroker struct {
+	up      chan struct{}
+	spooled func() int
+
+	mu       sync.Mutex
+	messages []*paho.Publish
+	pending  []int
+	sent     chan struct{}
+}
+
+func (b *flakyBroker) AwaitConnection(ctx context.Context) error {
+	select {
+	case <-b.up:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, p *paho.Publish) (*paho.PublishResponse, error) {
+	select {
+	case <-b.up:
+	default:
+		return nil, errors.New("connection down")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, p)
+	b.pending = append(b.pending, b.spooled())
+	b.sent <- struct{}{}
+	return &paho.PublishResponse{}, nil
+}
+
+func TestForwarderReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := spool.Open(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &flakyBroker{up: make(chan struct{}), spooled: q.Len, sent: make(chan struct{}, 10)}
+	var wg, pool sync.WaitGroup
+	fw := newForwarder(b, q, config{connectRetryDelay: time.Millisecond, publishQueueDepth: 10, publishDropPolicy: dropNone}, &wg)
+	fw.start(ctx, 1, &pool)
+	pool.Add(1)
+	go func() {
+		defer pool.Done()
+		fw.replay(ctx)
+	}()
+
+	// Readings taken whilst the broker is down are spooled
+	start := time.Now().Add(-10 * time.Minute).UTC()
+	var want []spool.Message
+	for i := 0; i < 5; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		m := spool.Message{Topic: strconv.Itoa(i), QoS: 1, Payload: []byte(`{"timestamp":"` + ts.Format(time.RFC3339Nano) + `"}`), Time: ts}
+		want = append(want, m)
+		fw.publish(ctx, m)
+	}
+	wg.Wait()
+	if got := q.Len(); got != len(want) {
+		t.Fatalf("unexpected value: got: %d messages spooled, want: %d", got, len(want))
+	}
+
+	close(b.up)
+	for range want {
+		select {
+		case <-b.sent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("unexpected value: got: %d messages replayed, want: %d", len(b.messages), len(want))
+		}
+	}
+	cancel()
+	pool.Wait()
+
+	for i, m := range b.messages {
+		if m.Topic != want[i].Topic || string(m.Payload) != string(want[i].Payload) {
+			t.Errorf("unexpected value: got: %s %s, want: %s %s", m.Topic, m.Payload, want[i].Topic, want[i].Payload)
+		}
+		// Each message is removed from the spool once sent, before the next one is replayed
+		if b.pending[i] != len(want)-i {
+			t.Errorf("unexpected value: got: %d messages spooled when replaying %s, want: %d", b.pending[i], m.Topic, len(want)-i)
+		}
+	}
+	if got := q.Len(); got != 0 {
+		t.Errorf("unexpected value: got: %d messages left in the spool, want: none", got)
+	}
+}
@@ -3,48 +3,87 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"net/url"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/eclipse/paho.golang/autopaho"
 	"github.com/eclipse/paho.golang/paho"
+	"github.com/lupinthe14th/acm/publisher/aggregate"
+	"github.com/lupinthe14th/acm/publisher/codec"
 	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/spool"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// Connect to the broker and publish a message periodically
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
 	// Default level for this example is info, unless debug flag is present
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
-	cfg, err := getConfig()
-	if err != nil {
-		log.Error().Msgf("error getting config: %s", err)
+	if err := runCommand(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Error().Msgf("%s", err)
 		os.Exit(1)
 	}
+}
 
+// serve connects to the broker and publishes messages periodically until a signal is caught
+func serve(cfg config) {
 	tlsConfig, err := newTLSConfig(cfg.caFile)
 	if err != nil {
 		log.Info().Msgf("TLS config: %s", err)
 	}
 	log.Debug().Msgf("TLS config: %v", tlsConfig)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup // messages in flight
+
+	// Sampling and replaying stop as soon as a signal is caught, whilst the messages in flight are given time to drain
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	defer stopSampling()
+	var workers sync.WaitGroup
+
+	// connUp is signalled every time the connection comes up so that discovery messages can be (re)sent
+	connUp := make(chan struct{}, 1)
+
 	cliCfg := autopaho.ClientConfig{
-		BrokerUrls:        []*url.URL{cfg.serverURL},
+		BrokerUrls:        cfg.serverURLs,
 		TlsCfg:            tlsConfig,
 		KeepAlive:         cfg.keepAlive,
 		ConnectRetryDelay: cfg.connectRetryDelay,
-		OnConnectionUp:    func(*autopaho.ConnectionManager, *paho.Connack) { log.Info().Msg("mqtt connection up") },
-		OnConnectError:    func(err error) { log.Error().Msgf("error whilst attempting connection: %s", err) },
-		Debug:             paho.NOOPLogger{},
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			log.Info().Msg("mqtt connection up")
+			if sampleCtx.Err() != nil { // shutting down
+				return
+			}
+			// Birth message; Publish will block so we run it in a goRoutine
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := publishStatus(ctx, cm, cfg, statusOnline); err != nil {
+					log.Error().Err(err).Msg("error publishing status")
+				}
+			}()
+			select {
+			case connUp <- struct{}{}:
+			default:
+			}
+		},
+		OnConnectError: func(err error) { log.Error().Msgf("error whilst attempting connection: %s", err) },
+		Debug:          paho.NOOPLogger{},
 		ClientConfig: paho.ClientConfig{
 			ClientID:      cfg.clientID,
 			OnClientError: func(err error) { log.Error().Msgf("server requested disconnect: %s", err) },
@@ -65,73 +104,219 @@ func main() {
 	}
 
 	cliCfg.SetUsernamePassword(cfg.username, []byte(cfg.password))
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	setWill(&cliCfg, cfg)
 
 	// Connect to the broker - this will return immediately after initiating the connection process
 	cm, err := autopaho.NewConnection(ctx, cliCfg)
 	if err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("error creating connection")
 	}
 
-	var wg sync.WaitGroup
+	// Readings taken whilst the broker is unreachable are kept on disk when a spool directory is configured
+	var q *spool.Queue
+	if cfg.spoolDir != "" {
+		if q, err = spool.Open(cfg.spoolDir, int64(cfg.spoolMaxBytes), cfg.spoolMaxAge); err != nil {
+			log.Fatal().Err(err).Msg("error opening spool")
+		}
+		log.Info().Msgf("spool %s holds %d messages", cfg.spoolDir, q.Len())
+	}
+	// A fixed pool of workers publishes the messages; they stop when the connection is shut down
+	var pool sync.WaitGroup
+	fw := newForwarder(cm, q, cfg, &wg)
+	fw.start(ctx, cfg.publishWorkers, &pool)
+	if q != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fw.replay(sampleCtx)
+		}()
+	}
+
+	// publish sends a message, spooling it if the broker cannot be reached
+	publish := func(topic string, retain bool, contentType string, payload []byte) {
+		fw.publish(ctx, spool.Message{Topic: topic, QoS: cfg.qos, Retain: retain, Payload: payload, Time: time.Now(), ContentType: contentType})
+	}
 
 	// Start off a goRoutine that publishes messages
-	wg.Add(1)
+	workers.Add(1)
 	go func() {
-		defer wg.Done()
-		ds, err := ds18b20.New()
-		if err != nil {
-			log.Fatal().Err(err)
+		defer workers.Done()
+		// Keep retrying until the bus shows up; the MQTT connection is unaffected
+		ds, err := openSensors(sampleCtx, cfg, func(st sensorStatus) {
+			msg, err := json.Marshal(st)
+			if err != nil {
+				log.Error().Msgf("error marshaling JSON: %s", err)
+				return
+			}
+			publish(sensorStatusTopic(cfg.topic), true, codec.JSON{}.ContentType(), msg)
+		})
+		if err != nil { // Should only happen when context is canceled
+			log.Info().Msgf("publisher done (openSensors: %s)", err)
+			return
 		}
+		defer ds.Close()
 		log.Debug().Msgf("%v", ds)
 
+		reg := sensor.NewRegistry()
+		reg.Add(ds)
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Error().Msgf("error getting hostname: %s", err)
+		}
+		tp := newTopics(cfg, hostname)
+
+		// announce publishes the retained Home Assistant discovery message for s; an empty message removes it
+		disc := newDiscovery(cfg, tp)
+		announce := func(s sensor.Sensor, present bool) {
+			if !cfg.haDiscovery {
+				return
+			}
+			var msg []byte
+			if present {
+				var err error
+				if msg, err = disc.config(s); err != nil {
+					log.Error().Msgf("error marshaling JSON: %s", err)
+					return
+				}
+			}
+			publish(disc.topic(s), true, codec.JSON{}.ContentType(), msg)
+		}
+		// Readings are summarised over a window before publishing when aggregation is on
+		var win *aggregate.Window
+		if cfg.aggregateWindow > 0 {
+			win = aggregate.New(cfg.aggregateWindow)
+		}
+
+		// Readings that did not move are held back until the heartbeat is due
+		db := newDeadband(cfg.deadband, cfg.maxSilence)
+		statuses := batchStatuses{} // statuses of the probes in the last batch published
+		for a, d := range cfg.probeDeadbands {
+			db.threshold(fmt.Sprintf("%x", a), d)
+		}
+
+		announced := map[string]sensor.Sensor{} // probes announced to Home Assistant
+		for _, s := range reg.Sensors() {
+			announced[s.ID()] = s
+		}
+
+		lastRescan := time.Now()
 		for {
 			// AwaitConnection will return immediately if connection is up; adding this call stops publication whilst
-			// connection is unavailable.
-			err = cm.AwaitConnection(ctx)
-			if err != nil { // Should only happen when context is canceled
-				log.Info().Msgf("publisher done (AwaitConnection: %s)", err)
-				return
+			// connection is unavailable. With a spool, sampling carries on and the readings are forwarded later.
+			if q == nil {
+				err = cm.AwaitConnection(sampleCtx)
+				if err != nil { // Should only happen when context is canceled
+					log.Info().Msgf("publisher done (AwaitConnection: %s)", err)
+					return
+				}
 			}
 
-			for _, d := range ds.GetDevs() {
-				e, err := d.Read()
+			// The broker may have lost the retained discovery messages, so send them again on every connection
+			select {
+			case <-connUp:
+				for _, s := range announced {
+					announce(s, true)
+				}
+			default:
+			}
+
+			// Look for probes that were plugged in or removed and announce them
+			if cfg.rescanInterval > 0 && time.Since(lastRescan) >= cfg.rescanInterval {
+				lastRescan = time.Now()
+				evs, err := reg.Rescan()
 				if err != nil {
-					log.Error().Msgf("error reading from device: %s", err)
+					log.Error().Msgf("error rescanning devices: %s", err)
+				}
+				for _, e := range evs {
+					db.forget(e.Sensor.ID())
+					if e.Type == sensor.Removed {
+						delete(announced, e.Sensor.ID())
+					} else {
+						announced[e.Sensor.ID()] = e.Sensor
+					}
+					announce(e.Sensor, e.Type != sensor.Removed)
+					msg, err := json.Marshal(newEvent(e, lastRescan))
+					if err != nil {
+						log.Error().Msgf("error marshaling JSON: %s", err)
+						continue
+					}
+					publish(eventTopic(tp, e.Sensor), false, codec.JSON{}.ContentType(), msg)
+				}
+			}
+
+			// Sample every probe with a single conversion per bus
+			var readings, failed []sensor.Result
+			for _, r := range reg.SampleAll(sampleCtx) {
+				if r.Err != nil {
+					failed = append(failed, r)
+				}
+				var re *ds18b20.ReadingError
+				if errors.Is(r.Err, sensor.ErrOffline) {
+					log.Debug().Msgf("skipping device: %s", r.Err)
+					continue
+				} else if errors.As(r.Err, &re) {
+					log.Warn().Str("status", re.Status.String()).Msgf("discarding reading: %s", r.Err)
+					continue
+				} else if r.Err != nil {
+					log.Error().Msgf("error reading from device: %s", r.Err)
 					continue
 				}
-				// The message could be anything; lets make it JSON containing a simple count (make it simpler to track the messages)
-				msg, err := json.Marshal(e)
+				readings = append(readings, r)
+			}
+
+			// When aggregating, readings are only published once the window closes
+			now := time.Now()
+			if win != nil {
+				for _, r := range readings {
+					win.Add(r.Sensor, r.Reading, now)
+				}
+				if readings = win.Flush(now); readings == nil {
+					failed = nil
+				}
+			}
+
+			// In batch mode every probe, read or not, goes into a single message
+			if cfg.batch {
+				changed := false
+				var es []codec.Entry
+				for _, r := range append(readings, failed...) {
+					e := batchEntry(r)
+					moved := r.Err == nil && db.pass(r.Sensor.ID(), r.Reading)
+					if moved || statuses.changed(e) {
+						changed = true
+					}
+					es = append(es, e)
+				}
+				if msg, err := cfg.encoder.EncodeBatch(now, es); err != nil {
+					log.Error().Msgf("error encoding batch: %s", err)
+				} else if changed {
+					publish(cfg.batchTopic, false, cfg.encoder.ContentType(), msg)
+					statuses.published(es)
+				} else {
+					log.Debug().Msg("no probe changed, not publishing batch")
+				}
+				readings = nil
+			}
+
+			for _, r := range readings {
+				if !db.pass(r.Sensor.ID(), r.Reading) {
+					log.Debug().Msgf("%s did not change, not publishing", sensor.Name(r.Sensor))
+					continue
+				}
+				msg, err := cfg.encoder.Encode(r.Sensor, r.Reading)
 				if err != nil {
-					log.Error().Msgf("error marshaling JSON: %s", err)
+					log.Error().Msgf("error encoding reading: %s", err)
 					continue
 				}
 
-				// Publish will block so we run it in a goRoutine
-				wg.Add(1)
-				go func(msg []byte, d ds18b20.Dev) {
-					defer wg.Done()
-					pr, err := cm.Publish(ctx, &paho.Publish{
-						QoS:     cfg.qos,
-						Topic:   strings.Join([]string{cfg.topic, d.String()}, "/"),
-						Payload: msg,
-					})
-					if err != nil {
-						log.Error().Err(err).Msg("error publishing")
-					} else if pr.ReasonCode != 0 && pr.ReasonCode != 16 { // 16 = Server received message but there are no subscribers
-						log.Info().Msgf("reason code %d received", pr.ReasonCode)
-					} else if cfg.printMessage {
-						log.Info().Msgf("sent message: %s", msg)
-					}
-				}(msg, d)
+				publish(tp.reading(r.Sensor), false, cfg.encoder.ContentType(), msg)
 			}
 
 			select {
 			case <-time.After(cfg.delayBetweenMessages):
 				log.Info().Msg("delay between messages")
-			case <-ctx.Done():
+			case <-sampleCtx.Done():
 				log.Info().Msg("publisher done")
 				return
 			}
@@ -144,8 +329,17 @@ func main() {
 
 	<-sig
 	log.Info().Msg("signal caught - exiting")
+
+	drain(cm, cfg, stopSampling, &workers, &wg)
 	cancel()
 
+	// Sampling may have been held up by a full queue; it has to stop before the publish workers so that nothing
+	// is queued once they are gone
+	workers.Wait()
+	pool.Wait()
 	wg.Wait()
+	if n := fw.droppedCount(); n > 0 {
+		log.Warn().Msgf("%d messages were dropped because the publish queue was full", n)
+	}
 	log.Info().Msg("shutdown complete")
 }
@@ -0,0 +1,188 @@
+// Package sensor defines the interface the publisher uses to drive probes,
+// independent of the hardware family or the way they are attached.
+package sensor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Kind identifies the physical quantity a Sensor measures.
+type Kind string
+
+const (
+	Temperature Kind = "temperature"
+)
+
+// Measurement is a single typed value taken by a Sensor.
+type Measurement struct {
+	Kind  Kind
+	Value float64
+	Unit  string
+}
+
+// Reading is a sample taken from a Sensor. The concrete type is what gets
+// published, so implementations are expected to be JSON serialisable.
+type Reading interface {
+	Measurements() []Measurement
+	Time() time.Time
+}
+
+// Stats summarises the primary measurement of a sensor over a window.
+type Stats struct {
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Mean  float64   `json:"mean"`
+	Count int       `json:"count"`
+	Last  float64   `json:"last"`
+	Start time.Time `json:"start"` // time of the first reading in the window
+	End   time.Time `json:"end"`   // time of the last reading in the window
+}
+
+// Summary is implemented by readings that can carry the statistics of the
+// window they close.
+type Summary interface {
+	Reading
+	Stats() *Stats              // nil unless the reading was aggregated
+	WithStats(st Stats) Reading // copy of the reading carrying st
+}
+
+// Sensor is implemented by every probe the publisher can drive.
+type Sensor interface {
+	ID() string                                  // stable identity, e.g. the 1-wire address
+	Kind() Kind                                  // primary quantity measured
+	Sample(ctx context.Context) (Reading, error) // take a reading, giving up when ctx is done
+}
+
+// Meta describes where a sensor is installed.
+type Meta struct {
+	Alias    string `json:"alias,omitempty"`    // human friendly name, e.g. "sump"
+	Tank     string `json:"tank,omitempty"`     // tank the sensor belongs to
+	Location string `json:"location,omitempty"` // position within the tank
+}
+
+// Describer is implemented by sensors that carry installation metadata.
+type Describer interface {
+	Meta() Meta
+}
+
+// Name returns the alias of s when it has one, otherwise its ID.
+func Name(s Sensor) string {
+	if d, ok := s.(Describer); ok {
+		if a := d.Meta().Alias; a != "" {
+			return a
+		}
+	}
+	return s.ID()
+}
+
+// Source provides a set of sensors, e.g. all DS18B20 probes found on a bus.
+type Source interface {
+	Sensors() []Sensor
+}
+
+// Result is the outcome of sampling a single sensor; Reading is nil when Err is set.
+type Result struct {
+	Sensor  Sensor
+	Reading Reading
+	Err     error
+}
+
+// BatchSampler is implemented by sources that can sample all of their sensors
+// at once more cheaply than one at a time.
+type BatchSampler interface {
+	SampleAll(ctx context.Context) []Result
+}
+
+// ErrOffline is wrapped by the error of a sensor that is no longer attached.
+var ErrOffline = errors.New("sensor is offline")
+
+// EventType tells whether a sensor appeared or disappeared.
+type EventType string
+
+const (
+	Added   EventType = "added"
+	Removed EventType = "removed"
+)
+
+// Event reports a change in the set of attached sensors.
+type Event struct {
+	Type   EventType
+	Sensor Sensor
+}
+
+// Rescanner is implemented by sources that can detect sensors being plugged
+// in or removed after start up.
+type Rescanner interface {
+	Rescan() ([]Event, error)
+}
+
+// Registry holds every source attached to this host.
+type Registry struct {
+	mu      sync.RWMutex
+	sources []Source
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add registers a source; its sensors are picked up on the next call to Sensors.
+func (r *Registry) Add(s Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources = append(r.sources, s)
+}
+
+// Sensors returns the sensors of every registered source, in registration order.
+func (r *Registry) Sensors() []Sensor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ss []Sensor
+	for _, src := range r.sources {
+		ss = append(ss, src.Sensors()...)
+	}
+	return ss
+}
+
+// SampleAll samples every sensor, using BatchSampler where the source supports it.
+func (r *Registry) SampleAll(ctx context.Context) []Result {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var rs []Result
+	for _, src := range r.sources {
+		if bs, ok := src.(BatchSampler); ok {
+			rs = append(rs, bs.SampleAll(ctx)...)
+			continue
+		}
+		for _, s := range src.Sensors() {
+			rd, err := s.Sample(ctx)
+			rs = append(rs, Result{Sensor: s, Reading: rd, Err: err})
+		}
+	}
+	return rs
+}
+
+// Rescan re-enumerates every source implementing Rescanner. Events are returned
+// even if some sources failed; the first error is returned alongside them.
+func (r *Registry) Rescan() ([]Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var evs []Event
+	var firstErr error
+	for _, src := range r.sources {
+		rs, ok := src.(Rescanner)
+		if !ok {
+			continue
+		}
+		e, err := rs.Rescan()
+		evs = append(evs, e...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return evs, firstErr
+}
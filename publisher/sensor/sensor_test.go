@@ -0,0 +1,144 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeReading struct {
+	value float64
+}
+
+func (r fakeReading) Measurements() []Measurement {
+	return []Measurement{{Kind: Temperature, Value: r.value, Unit: "Cel"}}
+}
+
+func (r fakeReading) Time() time.Time {
+	return time.Time{}
+}
+
+type fakeSensor struct {
+	id string
+}
+
+func (s fakeSensor) ID() string                              { return s.id }
+func (s fakeSensor) Kind() Kind                              { return Temperature }
+func (s fakeSensor) Sample(context.Context) (Reading, error) { return fakeReading{value: 25}, nil }
+
+type fakeSource []Sensor
+
+func (s fakeSource) Sensors() []Sensor { return s }
+
+// fakeBatch is a source that can only be sampled as a whole.
+type fakeBatch struct {
+	fakeSource
+	calls int
+}
+
+func (s *fakeBatch) SampleAll(context.Context) []Result {
+	s.calls++
+	var rs []Result
+	for _, ss := range s.fakeSource {
+		rs = append(rs, Result{Sensor: ss, Reading: fakeReading{value: 20}})
+	}
+	return rs
+}
+
+func TestRegistrySensors(t *testing.T) {
+	r := NewRegistry()
+	if got := len(r.Sensors()); got != 0 {
+		t.Fatalf("empty registry: got %d sensors, want 0", got)
+	}
+
+	r.Add(fakeSource{fakeSensor{id: "a"}, fakeSensor{id: "b"}})
+	r.Add(fakeSource{fakeSensor{id: "c"}})
+
+	got := r.Sensors()
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sensors, want %d", len(got), len(want))
+	}
+	for i, s := range got {
+		if s.ID() != want[i] {
+			t.Errorf("at index %d: got %s, want %s", i, s.ID(), want[i])
+		}
+	}
+}
+
+func TestRegistrySampleAll(t *testing.T) {
+	batch := &fakeBatch{fakeSource: fakeSource{fakeSensor{id: "b"}, fakeSensor{id: "c"}}}
+	r := NewRegistry()
+	r.Add(fakeSource{fakeSensor{id: "a"}})
+	r.Add(batch)
+
+	rs := r.SampleAll(context.Background())
+	if batch.calls != 1 {
+		t.Errorf("SampleAll called %d times on the batch source; want 1", batch.calls)
+	}
+	want := []float64{25, 20, 20}
+	if len(rs) != len(want) {
+		t.Fatalf("got %d results, want %d", len(rs), len(want))
+	}
+	for i, res := range rs {
+		if res.Err != nil {
+			t.Fatalf("at index %d: unexpected error %v", i, res.Err)
+		}
+		if v := res.Reading.Measurements()[0].Value; v != want[i] {
+			t.Errorf("at index %d: got %v, want %v", i, v, want[i])
+		}
+	}
+}
+
+type describedSensor struct {
+	fakeSensor
+	meta Meta
+}
+
+func (s describedSensor) Meta() Meta { return s.meta }
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name   string
+		sensor Sensor
+		want   string
+	}{
+		{name: "no metadata", sensor: fakeSensor{id: "293ce10457784c28"}, want: "293ce10457784c28"},
+		{name: "no alias", sensor: describedSensor{fakeSensor{id: "293ce10457784c28"}, Meta{Tank: "display"}}, want: "293ce10457784c28"},
+		{name: "alias", sensor: describedSensor{fakeSensor{id: "293ce10457784c28"}, Meta{Alias: "sump"}}, want: "sump"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Name(tt.sensor); got != tt.want {
+				t.Errorf("Name() = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRescanner reports a fixed set of events.
+type fakeRescanner struct {
+	fakeSource
+	events []Event
+	err    error
+}
+
+func (s fakeRescanner) Rescan() ([]Event, error) { return s.events, s.err }
+
+func TestRegistryRescan(t *testing.T) {
+	failure := errors.New("bus gone")
+	r := NewRegistry()
+	r.Add(fakeSource{fakeSensor{id: "a"}})
+	r.Add(fakeRescanner{err: failure})
+	r.Add(fakeRescanner{events: []Event{{Type: Added, Sensor: fakeSensor{id: "b"}}}})
+
+	evs, err := r.Rescan()
+	if err != failure {
+		t.Errorf("Rescan() error = %v; want %v", err, failure)
+	}
+	if len(evs) != 1 || evs[0].Type != Added || evs[0].Sensor.ID() != "b" {
+		t.Errorf("Rescan() = %v; want b added", evs)
+	}
+}
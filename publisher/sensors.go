@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/backoff"
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sensorsOK   = "ok"         // at least one probe was found
+	sensorsNone = "no sensors" // the bus is missing or no probe was found
+)
+
+var errNoSensors = errors.New("no sensors found")
+
+// sensorStatus is the payload reporting whether the probes could be opened
+type sensorStatus struct {
+	Status    string    `json:"status"`
+	Sensors   int       `json:"sensors"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// sensorStatusTopic returns the topic the sensor status is published on
+func sensorStatusTopic(base string) string {
+	return strings.Join([]string{base, "sensors"}, "/")
+}
+
+// openSensors opens the probes, retrying with backoff until at least one probe is found or ctx is done.
+// Every attempt is passed to report so that the outcome can be published.
+func openSensors(ctx context.Context, cfg config, report func(sensorStatus)) (*ds18b20.Devs, error) {
+	b := backoff.Backoff{Base: cfg.sensorRetryDelay, Max: cfg.sensorRetryMaxDelay}
+	for attempt := 0; ; attempt++ {
+		ds, err := ds18b20.Open(cfg.sensors)
+		if err == nil && len(ds.GetDevs()) == 0 {
+			err = errNoSensors
+		}
+		if err == nil {
+			report(sensorStatus{Status: sensorsOK, Sensors: len(ds.GetDevs()), Timestamp: time.Now()})
+			return ds, nil
+		}
+		if cerr := ds.Close(); cerr != nil {
+			log.Debug().Msgf("error closing sensors: %s", cerr)
+		}
+
+		log.Error().Msgf("error opening sensors (attempt %d): %s; retrying in %s", attempt+1, err, b.Delay(attempt))
+		report(sensorStatus{Status: sensorsNone, Error: err.Error(), Timestamp: time.Now()})
+		if err := b.Sleep(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lupinthe14th/acm/publisher/ds18b20"
+)
+
+func TestOpenSensors(t *testing.T) {
+	cfg := config{
+		sensors:             ds18b20.Config{Backend: ds18b20.BackendSim, Sim: ds18b20.SimConfig{Probes: 2}},
+		sensorRetryDelay:    time.Millisecond,
+		sensorRetryMaxDelay: time.Millisecond,
+	}
+	var got []sensorStatus
+	ds, err := openSensors(context.Background(), cfg, func(s sensorStatus) { got = append(got, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.GetDevs()) != 2 {
+		t.Errorf("unexpected value: got: %d devices, want: 2", len(ds.GetDevs()))
+	}
+	if len(got) != 1 || got[0].Status != sensorsOK || got[0].Sensors != 2 {
+		t.Errorf("unexpected value: got: %v, want: one %s status", got, sensorsOK)
+	}
+}
+
+func TestOpenSensorsRetry(t *testing.T) {
+	// The sysfs backend fails until the devices directory exists.
+	cfg := config{
+		sensors:             ds18b20.Config{Backend: ds18b20.BackendSysfs, SysfsRoot: t.TempDir() + "/w1"},
+		sensorRetryDelay:    time.Millisecond,
+		sensorRetryMaxDelay: 5 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var got []sensorStatus
+	ds, err := openSensors(ctx, cfg, func(s sensorStatus) { got = append(got, s) })
+	if err != context.DeadlineExceeded || ds != nil {
+		t.Fatalf("unexpected value: got: %v, %v, want: %v", ds, err, context.DeadlineExceeded)
+	}
+	if len(got) < 2 {
+		t.Fatalf("unexpected value: got: %d attempts, want: several", len(got))
+	}
+	for _, s := range got {
+		if s.Status != sensorsNone || s.Error == "" {
+			t.Errorf("unexpected value: got: %v, want: %s with an error", s, sensorsNone)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/rs/zerolog/log"
+)
+
+// drain shuts the publisher down cleanly within cfg.drainTimeout: sampling is stopped, the messages in flight are
+// given time to reach the broker, "offline" is published and the connection is closed with a DISCONNECT so that the
+// broker does not send our will.
+func drain(cm *autopaho.ConnectionManager, cfg config, stopSampling context.CancelFunc, workers, inFlight *sync.WaitGroup) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.drainTimeout)
+	defer cancel()
+
+	start := time.Now()
+	stopSampling()
+	if err := wait(ctx, workers); err != nil {
+		log.Error().Msgf("error stopping sampling: %s", err)
+	}
+	if err := wait(ctx, inFlight); err != nil {
+		log.Error().Msgf("error draining messages in flight: %s", err)
+	}
+	log.Info().Msgf("drained messages in flight in %s", time.Since(start))
+
+	// A clean exit does not trigger the will, so say goodbye ourselves
+	if err := publishStatus(ctx, cm, cfg, statusOffline); err != nil {
+		log.Error().Err(err).Msg("error publishing status")
+	}
+	if err := cm.Disconnect(ctx); err != nil {
+		log.Error().Msgf("error disconnecting: %s", err)
+	}
+}
+
+// wait waits for wg, giving up when ctx is done
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
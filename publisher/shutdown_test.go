@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	var wg sync.WaitGroup
+	if err := wait(context.Background(), &wg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wg.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := wait(ctx, &wg); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		wg.Done()
+	}()
+	if err := wait(context.Background(), &wg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package spool implements a bounded on-disk FIFO queue holding messages that
+// could not be published while the broker was unreachable.
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a publish waiting to be sent.
+type Message struct {
+	Topic   string    `json:"topic"`
+	QoS     byte      `json:"qos"`
+	Retain  bool      `json:"retain,omitempty"`
+	Payload []byte    `json:"payload"`
+	Time    time.Time `json:"time"` // when the message was produced
+
+	ContentType string `json:"contentType,omitempty"` // MIME type of the payload
+
+	Seq uint64 `json:"-"` // position in the queue, set by Peek
+}
+
+const ext = ".msg"
+
+// entry is a message file; its name holds the sequence number and the message
+// time so that the queue can be bounded without reading the files.
+type entry struct {
+	seq  uint64
+	time time.Time
+	size int64
+}
+
+func (e entry) name() string {
+	return fmt.Sprintf("%020d-%d%s", e.seq, e.time.UnixNano(), ext)
+}
+
+// Queue is a FIFO of messages stored one per file in a directory. It is safe
+// for concurrent use.
+type Queue struct {
+	dir      string
+	maxBytes int64         // 0 means unbounded
+	maxAge   time.Duration // 0 means unbounded
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries []entry // oldest first
+	size    int64
+	next    uint64
+}
+
+// Open opens the queue stored in dir, creating the directory if needed.
+// Messages left by a previous run are kept.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxBytes: maxBytes, maxAge: maxAge, now: time.Now}
+	for _, f := range files {
+		e, ok := parseName(f.Name())
+		if !ok {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		e.size = info.Size()
+		q.entries = append(q.entries, e)
+		q.size += e.size
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	if n := len(q.entries); n > 0 {
+		q.next = q.entries[n-1].seq + 1
+	}
+	return q, q.trim()
+}
+
+func parseName(name string) (entry, bool) {
+	if !strings.HasSuffix(name, ext) {
+		return entry{}, false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(name, ext), "-", 2)
+	if len(parts) != 2 {
+		return entry{}, false
+	}
+	seq, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	ns, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	return entry{seq: seq, time: time.Unix(0, ns)}, true
+}
+
+// Len returns the number of queued messages.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Push appends m to the queue, dropping the oldest messages if the queue
+// grows beyond its bounds.
+func (q *Queue) Push(m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e := entry{seq: q.next, time: m.Time, size: int64(len(data))}
+	// Write to a temporary file first so a crash never leaves a partial message.
+	tmp := filepath.Join(q.dir, e.name()+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, e.name())); err != nil {
+		return err
+	}
+	q.next++
+	q.entries = append(q.entries, e)
+	q.size += e.size
+	return q.trim()
+}
+
+// Peek returns the oldest message without removing it; ok is false when the
+// queue is empty. Unreadable messages are discarded.
+func (q *Queue) Peek() (m Message, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.trim(); err != nil {
+		return Message{}, false, err
+	}
+	for len(q.entries) > 0 {
+		e := q.entries[0]
+		data, err := os.ReadFile(filepath.Join(q.dir, e.name()))
+		if err == nil {
+			err = json.Unmarshal(data, &m)
+		}
+		if err != nil {
+			if rerr := q.removeFirst(); rerr != nil {
+				return Message{}, false, rerr
+			}
+			continue
+		}
+		m.Seq = e.seq
+		return m, true, nil
+	}
+	return Message{}, false, nil
+}
+
+// Remove deletes the message with the given sequence number, as returned by
+// Peek. It is not an error if the message was already dropped.
+func (q *Queue) Remove(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 || q.entries[0].seq != seq {
+		return nil
+	}
+	return q.removeFirst()
+}
+
+// trim drops the oldest messages until the queue is within its bounds.
+func (q *Queue) trim() error {
+	for len(q.entries) > 0 {
+		e := q.entries[0]
+		tooBig := q.maxBytes > 0 && q.size > q.maxBytes
+		tooOld := q.maxAge > 0 && q.now().Sub(e.time) > q.maxAge
+		if !tooBig && !tooOld {
+			return nil
+		}
+		if err := q.removeFirst(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) removeFirst() error {
+	e := q.entries[0]
+	if err := os.Remove(filepath.Join(q.dir, e.name())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	q.entries = q.entries[1:]
+	q.size -= e.size
+	return nil
+}
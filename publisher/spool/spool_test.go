@@ -0,0 +1,156 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func drain(t *testing.T, q *Queue) []string {
+	t.Helper()
+	var topics []string
+	for {
+		m, ok, err := q.Peek()
+		if err != nil {
+			t.Fatalf("Peek() error = %v", err)
+		}
+		if !ok {
+			return topics
+		}
+		topics = append(topics, m.Topic)
+		if err := q.Remove(m.Seq); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+	for _, topic := range []string{"a", "b", "c"} {
+		if err := q.Push(Message{Topic: topic, QoS: 1, Payload: []byte(`{"temperature":25}`), Time: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, ok, err := q.Peek()
+	if err != nil || !ok {
+		t.Fatalf("Peek() = %v, %v; want a message", ok, err)
+	}
+	if m.Topic != "a" || m.QoS != 1 || string(m.Payload) != `{"temperature":25}` || !m.Time.Equal(ts) {
+		t.Errorf("unexpected value: got: %+v", m)
+	}
+
+	// Messages survive a restart
+	q, err = Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(t, q); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("unexpected value: got: %v, want: [a b c]", got)
+	}
+	if err := q.Push(Message{Topic: "d", Time: ts}); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(t, q); len(got) != 1 || got[0] != "d" {
+		t.Errorf("unexpected value: got: %v, want: [d]", got)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spool directory not empty: %v", files)
+	}
+}
+
+func TestQueueBounds(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		maxAge    time.Duration
+		times     []time.Duration // message age
+		wantValue []string
+	}{
+		{name: "unbounded", times: []time.Duration{3 * time.Hour, time.Hour, 0}, wantValue: []string{"0", "1", "2"}},
+		{name: "too old", maxAge: 2 * time.Hour, times: []time.Duration{3 * time.Hour, time.Hour, 0}, wantValue: []string{"1", "2"}},
+		{name: "too big", maxBytes: 250, times: []time.Duration{0, 0, 0}, wantValue: []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Open(t.TempDir(), tt.maxBytes, tt.maxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.now = func() time.Time { return now }
+			for i, age := range tt.times {
+				m := Message{Topic: string(rune('0' + i)), Payload: []byte("0123456789012345678901234567890123456789"), Time: now.Add(-age)}
+				if err := q.Push(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := drain(t, q)
+			if len(got) != len(tt.wantValue) {
+				t.Fatalf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+			}
+			for i := range got {
+				if got[i] != tt.wantValue[i] {
+					t.Errorf("unexpected value: got: %v, want: %v", got, tt.wantValue)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueRemoveDropped(t *testing.T) {
+	q, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"a", "b"} {
+		if err := q.Push(Message{Topic: topic, Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, _, _ := q.Peek()
+	if err := q.Remove(m.Seq); err != nil {
+		t.Fatal(err)
+	}
+	// Removing a message that is no longer at the head must not drop the next one
+	if err := q.Remove(m.Seq); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("unexpected value: got: %d, want: 1", q.Len())
+	}
+}
+
+func TestOpenSkipsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000007-0.msg"), []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	q, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Fatalf("unexpected value: got: %d, want: 1", q.Len())
+	}
+	// The corrupt message is discarded when read
+	if _, ok, err := q.Peek(); ok || err != nil {
+		t.Errorf("Peek() = %v, %v; want empty", ok, err)
+	}
+	if err := q.Push(Message{Topic: "a", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _, _ := q.Peek(); m.Seq != 8 {
+		t.Errorf("unexpected value: got: %d, want: 8", m.Seq)
+	}
+}
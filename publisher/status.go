@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Payloads of the retained availability message on the status topic
+const (
+	statusOnline  = "online"  // birth message, sent every time the connection comes up
+	statusOffline = "offline" // sent on shutdown, and by the broker as our will if the connection is lost
+)
+
+// statusContentType is the content type of the availability payloads
+const statusContentType = "text/plain; charset=utf-8"
+
+// defaultStatusTopic returns the status topic used when none is configured
+func defaultStatusTopic(base string) string {
+	return strings.Join([]string{base, "status"}, "/")
+}
+
+// setWill makes the broker publish "offline" on the status topic if the connection is lost
+func setWill(cliCfg *autopaho.ClientConfig, cfg config) {
+	cliCfg.SetWillMessage(cfg.statusTopic, []byte(statusOffline), cfg.qos, true)
+	cliCfg.SetConnectPacketConfigurator(configureWill)
+}
+
+// configureWill adjusts the properties autopaho gives the will in the connect packet
+func configureWill(c *paho.Connect) *paho.Connect {
+	if c.WillProperties == nil {
+		return c
+	}
+	// autopaho sends a message expiry of 0, which some brokers take as "discard the retained will at once"
+	utf8 := byte(1)
+	c.WillProperties.MessageExpiry = nil
+	c.WillProperties.PayloadFormat = &utf8
+	c.WillProperties.ContentType = statusContentType
+	return c
+}
+
+// publishStatus publishes the retained availability of the publisher
+func publishStatus(ctx context.Context, cm broker, cfg config, status string) error {
+	_, err := cm.Publish(ctx, &paho.Publish{
+		QoS:        cfg.qos,
+		Retain:     true,
+		Topic:      cfg.statusTopic,
+		Payload:    []byte(status),
+		Properties: &paho.PublishProperties{ContentType: statusContentType},
+	})
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+func TestConfigureWill(t *testing.T) {
+	expiry := uint32(0)
+	c := configureWill(&paho.Connect{
+		WillMessage:    &paho.WillMessage{Topic: "/example/sensors/status", Payload: []byte(statusOffline), Retain: true},
+		WillProperties: &paho.WillProperties{MessageExpiry: &expiry},
+	})
+	p := c.WillProperties
+	if p.MessageExpiry != nil {
+		t.Errorf("unexpected value: got: message expiry %d, want: none", *p.MessageExpiry)
+	}
+	if p.PayloadFormat == nil || *p.PayloadFormat != 1 {
+		t.Errorf("unexpected value: got: payload format %v, want: 1", p.PayloadFormat)
+	}
+	if p.ContentType != statusContentType {
+		t.Errorf("unexpected value: got: %q, want: %q", p.ContentType, statusContentType)
+	}
+	if string(c.WillMessage.Payload) != statusOffline || !c.WillMessage.Retain {
+		t.Errorf("unexpected value: got: %+v, want: a retained %s", c.WillMessage, statusOffline)
+	}
+
+	// Nothing to adjust without a will
+	if c := configureWill(&paho.Connect{}); c.WillProperties != nil {
+		t.Errorf("unexpected value: got: %+v, want: nil", c.WillProperties)
+	}
+}
+
+func TestPublishStatus(t *testing.T) {
+	b := newFakeBroker()
+	close(b.release)
+	cfg := config{qos: 1, statusTopic: "/example/sensors/status"}
+	if err := publishStatus(context.Background(), b, cfg, statusOnline); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.published) != 1 {
+		t.Fatalf("unexpected value: got: %d messages, want: 1", len(b.published))
+	}
+	p := b.published[0]
+	if p.Topic != cfg.statusTopic || string(p.Payload) != statusOnline || !p.Retain || p.QoS != 1 {
+		t.Errorf("unexpected value: got: %s %q retain %t qos %d, want: a retained %s on %s", p.Topic, p.Payload, p.Retain, p.QoS, statusOnline, cfg.statusTopic)
+	}
+	if p.Properties == nil || p.Properties.ContentType != statusContentType {
+		t.Errorf("unexpected value: got: %+v, want: content type %q", p.Properties, statusContentType)
+	}
+}
@@ -0,0 +1,143 @@
+// Package topic builds publish topics from templates such as
+// "{site}/{tank}/{kind}/{alias}".
+package topic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Variables a template may refer to.
+const (
+	VarTopic    = "topic"    // base topic from the configuration
+	VarSite     = "site"     // site name from the configuration
+	VarClientID = "clientID" // MQTT client id
+	VarHostname = "hostname" // name of this host
+	VarID       = "id"       // sensor ID, e.g. the 1-wire address
+	VarAlias    = "alias"    // sensor alias, or its ID if it has none
+	VarTank     = "tank"     // tank the sensor belongs to
+	VarLocation = "location" // position of the sensor within the tank
+	VarKind     = "kind"     // quantity measured, e.g. "temperature"
+)
+
+// Variables lists the variables accepted by Parse.
+var Variables = []string{VarTopic, VarSite, VarClientID, VarHostname, VarID, VarAlias, VarTank, VarLocation, VarKind}
+
+// Unknown replaces variables without a value so that no topic level is empty.
+const Unknown = "unknown"
+
+// Validate reports whether t can be published to: it must not be empty, nor
+// contain wildcards or the null character.
+func Validate(t string) error {
+	switch {
+	case t == "":
+		return errors.New("topic must not be empty")
+	case strings.ContainsAny(t, "+#"):
+		return fmt.Errorf("topic %q must not contain the wildcards + or #", t)
+	case strings.ContainsRune(t, 0):
+		return fmt.Errorf("topic %q must not contain the null character", t)
+	case len(t) > 65535:
+		return fmt.Errorf("topic must not be longer than 65535 bytes (is %d)", len(t))
+	}
+	return nil
+}
+
+// part is either literal text or, if variable is set, a variable reference.
+type part struct {
+	literal  string
+	variable string
+}
+
+// Template is a parsed topic template.
+type Template struct {
+	parts []part
+}
+
+// Parse parses a template; variables are written as {name} and at least one of
+// {id} or {alias} is required.
+func Parse(s string) (Template, error) {
+	if s == "" {
+		return Template{}, errors.New("template must not be empty")
+	}
+	var t Template
+	for rest := s; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return Template{}, fmt.Errorf("template %q has an unterminated variable", s)
+		}
+		name := rest[open+1 : open+end]
+		if !known(name) {
+			return Template{}, fmt.Errorf("template %q refers to unknown variable {%s} (must be one of %s)", s, name, strings.Join(Variables, ", "))
+		}
+		t.parts = append(t.parts, part{variable: name})
+		rest = rest[open+end+1:]
+	}
+	perSensor := false
+	for _, p := range t.parts {
+		if strings.ContainsAny(p.literal, "+#}") {
+			return Template{}, fmt.Errorf("template %q must not contain the wildcards + or # nor an unmatched }", s)
+		}
+		perSensor = perSensor || p.variable == VarID || p.variable == VarAlias
+	}
+	// Without them every sensor would publish on the same topic
+	if !perSensor {
+		return Template{}, fmt.Errorf("template %q must refer to {%s} or {%s}", s, VarID, VarAlias)
+	}
+	return t, nil
+}
+
+func known(name string) bool {
+	for _, v := range Variables {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute renders the template. Wildcards in the values are replaced by "_",
+// and variables without a value by Unknown.
+func (t Template) Execute(vars map[string]string) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.variable == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		v := vars[p.variable]
+		if v == "" {
+			v = Unknown
+		}
+		b.WriteString(wildcards.Replace(v))
+	}
+	return b.String()
+}
+
+var wildcards = strings.NewReplacer("+", "_", "#", "_")
+
+// Level escapes v so that it fills a single topic level.
+func Level(v string) string {
+	return strings.ReplaceAll(v, "/", "_")
+}
+
+// String returns the template as written.
+func (t Template) String() string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.variable == "" {
+			b.WriteString(p.literal)
+		} else {
+			b.WriteString("{" + p.variable + "}")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package topic
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		isErr bool
+	}{
+		{name: "valid case", value: "/example/sensors", isErr: false},
+		{name: "blank case", value: "", isErr: true},
+		{name: "multi level wildcard case", value: "/example/#", isErr: true},
+		{name: "single level wildcard case", value: "/example/+/sensors", isErr: true},
+		{name: "null character case", value: "a\x00b", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.value); (err != nil) != tt.isErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	vars := map[string]string{
+		VarTopic: "acm/pi", VarSite: "home", VarAlias: "sump", VarTank: "display", VarKind: "temperature", VarHostname: "pi+1",
+	}
+	tests := []struct {
+		name      string
+		template  string
+		wantValue string
+		isErr     bool
+	}{
+		{name: "default case", template: "{topic}/{alias}", wantValue: "acm/pi/sump"},
+		{name: "site case", template: "{site}/{tank}/{kind}/{alias}", wantValue: "home/display/temperature/sump"},
+		{name: "literal case", template: "tanks/{tank}-{kind}/{alias}", wantValue: "tanks/display-temperature/sump"},
+		{name: "missing value case", template: "{site}/{location}/{alias}", wantValue: "home/unknown/sump"},
+		{name: "wildcard in value case", template: "{hostname}/{alias}", wantValue: "pi_1/sump"},
+		{name: "blank case", template: "", isErr: true},
+		{name: "unknown variable case", template: "{topic}/{room}", isErr: true},
+		{name: "no sensor variable case", template: "{site}/{kind}", isErr: true},
+		{name: "unterminated case", template: "{topic}/{alias", isErr: true},
+		{name: "unmatched brace case", template: "{topic}/alias}", isErr: true},
+		{name: "wildcard case", template: "/example/#", isErr: true},
+		{name: "single level wildcard case", template: "{topic}/+/{alias}", isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if got := tmpl.Execute(vars); got != tt.wantValue {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.wantValue)
+			}
+			if got := tmpl.String(); got != tt.template {
+				t.Errorf("unexpected value: got: %s, want: %s", got, tt.template)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	if got := Level("left/back"); got != "left_back" {
+		t.Errorf("unexpected value: got: %s, want: left_back", got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/lupinthe14th/acm/publisher/sensor"
+	"github.com/lupinthe14th/acm/publisher/topic"
+)
+
+// defaultTopicTemplate publishes the readings of every probe under the base topic, as <topic>/<alias>
+const defaultTopicTemplate = "{topic}/{alias}"
+
+// topics renders the topics the readings are published on
+type topics struct {
+	tmpl topic.Template
+	vars map[string]string // values that are the same for every probe
+}
+
+func newTopics(cfg config, hostname string) topics {
+	return topics{
+		tmpl: cfg.topicTemplate,
+		vars: map[string]string{
+			topic.VarTopic:    cfg.topic,
+			topic.VarSite:     topic.Level(cfg.site),
+			topic.VarClientID: topic.Level(cfg.clientID),
+			topic.VarHostname: topic.Level(hostname),
+		},
+	}
+}
+
+// reading returns the topic the readings of s are published on
+func (t topics) reading(s sensor.Sensor) string {
+	vars := map[string]string{
+		topic.VarID:    topic.Level(s.ID()),
+		topic.VarAlias: topic.Level(sensor.Name(s)),
+		topic.VarKind:  topic.Level(string(s.Kind())),
+	}
+	if d, ok := s.(sensor.Describer); ok {
+		m := d.Meta()
+		vars[topic.VarTank] = topic.Level(m.Tank)
+		vars[topic.VarLocation] = topic.Level(m.Location)
+	}
+	for k, v := range t.vars {
+		vars[k] = v
+	}
+	return t.tmpl.Execute(vars)
+}